@@ -0,0 +1,97 @@
+package jmsh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIError is returned by API calls when Jumpserver answers with an error
+// status, use IsNotFound and IsPermissionDenied to tell common ones apart
+type APIError struct {
+	StatusCode int
+	// Method and Endpoint are method and path of the failed request
+	Method   string
+	Endpoint string
+	// Detail and Code come from error body of Jumpserver, they're empty if
+	// the body isn't json, e.g. an error page of a reverse proxy
+	Detail string
+	Code   string
+	// RequestID identifies the request in server logs, if server tells it
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s failed: %d %s", e.Method, e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// IsNotFound tells whether err is an APIError of missing resource
+func IsNotFound(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && (e.StatusCode == http.StatusNotFound || e.Code == "not_found")
+}
+
+// IsPermissionDenied tells whether err is an APIError of an authenticated
+// user lacking permission
+func IsPermissionDenied(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && (e.StatusCode == http.StatusForbidden || e.Code == "permission_denied")
+}
+
+// newAPIError builds APIError of response r with body content
+func newAPIError(r *http.Response, content []byte) *APIError {
+	e := &APIError{
+		StatusCode: r.StatusCode,
+		Method:     r.Request.Method,
+		Endpoint:   r.Request.URL.Path,
+		RequestID:  r.Header.Get("X-Request-Id"),
+	}
+	e.Detail, e.Code = parseErrorBody(content)
+	return e
+}
+
+// parseErrorBody extracts message and code of django rest framework error
+// body, which is either {"detail": ..., "code": ...}, {"error": ...},
+// errors of fields like {"name": ["..."]}, or a list of messages
+func parseErrorBody(content []byte) (string, string) {
+	var list []string
+	if err := json.Unmarshal(content, &list); err == nil {
+		return strings.Join(list, " "), ""
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(content, &body); err != nil {
+		return "", ""
+	}
+	var detail, code string
+	json.Unmarshal(body["code"], &code)
+	for _, key := range []string{"detail", "error", "msg"} {
+		if json.Unmarshal(body[key], &detail) == nil && detail != "" {
+			return detail, code
+		}
+	}
+
+	var fields []string
+	for field, raw := range body {
+		if field == "code" {
+			continue
+		}
+		var messages []string
+		if json.Unmarshal(raw, &messages) == nil && len(messages) > 0 {
+			fields = append(fields, field+": "+strings.Join(messages, " "))
+		}
+	}
+	// map iteration order is random
+	sort.Strings(fields)
+	return strings.Join(fields, "; "), code
+}
@@ -0,0 +1,54 @@
+package jmsh
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
+
+	_, err := c.ListSystemUsers("missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Detail != "Not found." ||
+		apiErr.Endpoint != "/api/v1/perms/users/assets/missing/system-users/" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+	if !IsNotFound(err) || IsPermissionDenied(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	fs.version = 3
+	c = login(t, fs)
+	var out bytes.Buffer
+	_, err = c.ExecAsset("asset-1", "nobody", "uptime", &out)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Detail != "account: Account not found" {
+		t.Fatalf("expected APIError of bad request, got %v", err)
+	}
+}
+
+func TestParseErrorBody(t *testing.T) {
+	cases := []struct {
+		body   string
+		detail string
+		code   string
+	}{
+		{`{"detail":"You do not have permission.","code":"permission_denied"}`, "You do not have permission.", "permission_denied"},
+		{`{"error":"invalid token"}`, "invalid token", ""},
+		{`{"name":["This field is required."],"address":["Invalid."]}`, "address: Invalid.; name: This field is required.", ""},
+		{`["Something went wrong"]`, "Something went wrong", ""},
+		{`<html>502 Bad Gateway</html>`, "", ""},
+	}
+	for _, tc := range cases {
+		detail, code := parseErrorBody([]byte(tc.body))
+		if detail != tc.detail || code != tc.code {
+			t.Errorf("%s: expected %q %q, got %q %q", tc.body, tc.detail, tc.code, detail, code)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package jmsh
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// authenticator adds credentials to requests, it's used by clients which
+// don't log in with form and cookies
+type authenticator interface {
+	authorize(req *http.Request) error
+}
+
+// WithAccessKey signs every request with a Jumpserver Access Key using
+// HTTP Signature, suitable for automation accounts
+func WithAccessKey(keyID, secret string) Option {
+	return func(c *Client) error {
+		return c.setAuthenticator(&accessKeyAuth{keyID: keyID, secret: secret})
+	}
+}
+
+// WithPrivateToken authenticates every request with a private token, which
+// is configured on Jumpserver side as a user's permanent token
+func WithPrivateToken(token string) Option {
+	return func(c *Client) error {
+		return c.setAuthenticator(&tokenAuth{keyword: "Token", token: token})
+	}
+}
+
+// WithBearerToken authenticates every request with a bearer token obtained
+// from /api/v1/authentication/auth/
+func WithBearerToken(token string) Option {
+	return func(c *Client) error {
+		return c.setAuthenticator(&tokenAuth{keyword: "Bearer", token: token})
+	}
+}
+
+// ErrSessionExpired is returned by API calls when Jumpserver no longer
+// accepts the session, i.e. it redirects to login page or answers 401
+var ErrSessionExpired = errors.New("session expired, please log in again")
+
+// WithReauthenticate registers fn to log in again when session expired,
+// the failed call is retried once after fn succeeds
+func WithReauthenticate(fn func(c *Client) error) Option {
+	return func(c *Client) error {
+		c.reauth = fn
+		return nil
+	}
+}
+
+// withReauth calls f, and again after re-authentication if session
+// expired. Concurrent calls failed with the same session share one
+// re-authentication
+func (c *Client) withReauth(f func() error) error {
+	c.reauthMu.Lock()
+	gen := c.reauthGen
+	c.reauthMu.Unlock()
+
+	err := f()
+	if !errors.Is(err, ErrSessionExpired) || c.reauth == nil {
+		return err
+	}
+
+	c.reauthMu.Lock()
+	if c.reauthGen == gen {
+		if err := c.reauth(c); err != nil {
+			c.reauthMu.Unlock()
+			return fmt.Errorf("failed to log in again: %s", err)
+		}
+		c.reauthGen++
+	}
+	c.reauthMu.Unlock()
+	return f()
+}
+
+// sessionExpired tells whether response means the request wasn't
+// authenticated, rather than denied for lack of permission
+func sessionExpired(r *http.Response, content []byte) bool {
+	if strings.HasPrefix(r.Request.URL.Path, "/core/auth/login/") || r.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if r.StatusCode != http.StatusForbidden {
+		return false
+	}
+	// django rest framework answers 403 if it has no way to challenge,
+	// code is only there if server's exception handler adds it, otherwise
+	// detail is what tells, in English or Chinese
+	detail, code := parseErrorBody(content)
+	if code != "" {
+		return code == "not_authenticated"
+	}
+	for _, d := range notAuthenticatedDetails {
+		if detail == d {
+			return true
+		}
+	}
+	return false
+}
+
+// notAuthenticatedDetails are messages of NotAuthenticated of django rest
+// framework in languages Jumpserver ships
+var notAuthenticatedDetails = []string{
+	"Authentication credentials were not provided.",
+	"身份认证信息未提供。",
+}
+
+func (c *Client) setAuthenticator(auth authenticator) error {
+	if c.auth != nil {
+		return fmt.Errorf("only one authentication method could be used")
+	}
+	c.auth = auth
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Transport = &authTransport{auth: auth, next: next}
+	return nil
+}
+
+type authTransport struct {
+	auth authenticator
+	next http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper must not modify the original request
+	req = req.Clone(req.Context())
+	if err := t.auth.authorize(req); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+type tokenAuth struct {
+	keyword string
+	token   string
+}
+
+func (a *tokenAuth) authorize(req *http.Request) error {
+	req.Header.Set("Authorization", a.keyword+" "+a.token)
+	return nil
+}
+
+type accessKeyAuth struct {
+	keyID  string
+	secret string
+}
+
+// signedHeaders are what Jumpserver expects in signature
+var signedHeaders = []string{"(request-target)", "accept", "date"}
+
+func (a *accessKeyAuth) authorize(req *http.Request) error {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	var lines []string
+	for _, h := range signedHeaders {
+		if h == "(request-target)" {
+			lines = append(lines, fmt.Sprintf("%s: %s %s", h, strings.ToLower(req.Method), req.URL.RequestURI()))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", h, req.Header.Get(h)))
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		`Signature keyId="%s",algorithm="hmac-sha256",headers="%s",signature="%s"`,
+		a.keyID, strings.Join(signedHeaders, " "), signature,
+	))
+	return nil
+}
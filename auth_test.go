@@ -0,0 +1,182 @@
+package jmsh
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTokenAuthentication(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.privateToken = "private-token"
+	fs.accessKeyID = "ak-id"
+	fs.accessKeySecret = "ak-secret"
+
+	cases := []struct {
+		name string
+		opt  Option
+		ok   bool
+	}{
+		{"private token", WithPrivateToken("private-token"), true},
+		{"wrong private token", WithPrivateToken("wrong"), false},
+		{"access key", WithAccessKey("ak-id", "ak-secret"), true},
+		{"wrong access key secret", WithAccessKey("ak-id", "wrong"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewClient(fs.URL, tc.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, err := c.IsLoggedIn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.ok {
+				t.Fatalf("expected logged in %v, got %v", tc.ok, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if _, found, err := c.FindAssetByHostname("node1"); err != nil || !found {
+				t.Fatalf("failed to find asset: %v", err)
+			}
+			var out bytes.Buffer
+			if _, err := c.ExecAsset("asset-1", "su-root", "uptime", &out); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if _, err := NewClient(fs.URL, WithPrivateToken("a"), WithAccessKey("b", "c")); err == nil {
+		t.Fatal("expected error combining authentication methods")
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	fs := newFakeJumpserver(t)
+
+	c := login(t, fs)
+	fs.expireSessions()
+	if _, err := c.ListSystemUsers("asset-1"); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected ErrSessionExpired, got %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := c.ExecAsset("asset-1", "su-root", "uptime", &out); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("expected ErrSessionExpired, got %v", err)
+	}
+
+	var calls int32
+	c, err := NewClient(fs.URL, WithReauthenticate(func(c *Client) error {
+		atomic.AddInt32(&calls, 1)
+		lp, err := c.FetchLoginPage()
+		if err != nil {
+			return err
+		}
+		_, err = lp.Submit(fs.username, fs.password, "")
+		return err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nobody logged in yet, then session expires concurrently
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.ListSystemUsers("asset-1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected to log in once, got %d", calls)
+	}
+
+	fs.expireSessions()
+	if _, err := c.ExecAsset("asset-1", "su-root", "uptime", &out); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected to log in again, got %d", calls)
+	}
+}
+
+// TestReauthenticateOnChallenge covers other ways server tells session is
+// gone than 401
+func TestReauthenticateOnChallenge(t *testing.T) {
+	for _, unauthenticated := range []string{"403", "403-detail", "redirect"} {
+		t.Run(unauthenticated, func(t *testing.T) {
+			fs := newFakeJumpserver(t)
+			fs.unauthenticated = unauthenticated
+
+			var calls int32
+			c, err := NewClient(fs.URL, WithReauthenticate(func(c *Client) error {
+				atomic.AddInt32(&calls, 1)
+				lp, err := c.FetchLoginPage()
+				if err != nil {
+					return err
+				}
+				_, err = lp.Submit(fs.username, fs.password, "")
+				return err
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			users, err := c.ListSystemUsers("asset-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 1 || calls != 1 {
+				t.Fatalf("expected system users after logging in once, got %v after %d", users, calls)
+			}
+
+			fs.expireSessions()
+			if _, found, err := c.FindAssetByHostname("node1"); err != nil || !found {
+				t.Fatalf("failed to find asset: %v", err)
+			}
+			if calls != 2 {
+				t.Fatalf("expected to log in again, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/users/profile/", nil)
+	for _, tc := range []struct {
+		status  int
+		content string
+		expired bool
+	}{
+		{401, `{"detail":"Authentication credentials were not provided."}`, true},
+		{403, `{"detail":"身份认证信息未提供。","code":"not_authenticated"}`, true},
+		{403, `{"detail":"You do not have permission to perform this action.","code":"permission_denied"}`, false},
+		{403, `{"detail":"Authentication credentials were not provided."}`, true},
+		{403, `{"detail":"身份认证信息未提供。"}`, true},
+		{403, `{"detail":"Authentication credentials were not provided.","code":"permission_denied"}`, false},
+		{403, `{"detail":"You do not have permission to perform this action."}`, false},
+		{200, `{"username":"admin"}`, false},
+	} {
+		r := &http.Response{StatusCode: tc.status, Request: req}
+		if got := sessionExpired(r, []byte(tc.content)); got != tc.expired {
+			t.Errorf("sessionExpired(%d, %s) = %v, want %v", tc.status, tc.content, got, tc.expired)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/living42/jmsh"
+)
+
+// authentication methods, used in config
+const (
+	authPassword  = "password"
+	authAccessKey = "accesskey"
+	authToken     = "token"
+)
+
+// tokenAuthOption builds client option for non-interactive authentication.
+// Secret is read from environment first, so automation doesn't need a
+// credential store
+func tokenAuthOption(config Config, store CredentialStore) (jmsh.Option, error) {
+	var env string
+	switch config.Auth {
+	case authAccessKey:
+		if config.AccessKeyID == "" {
+			return nil, fmt.Errorf("accessKeyId must be set to authenticate with access key")
+		}
+		env = "JMSH_ACCESS_KEY_SECRET"
+	case authToken:
+		env = "JMSH_PRIVATE_TOKEN"
+	default:
+		return nil, fmt.Errorf("unknown auth %q", config.Auth)
+	}
+
+	secret := os.Getenv(env)
+	if secret == "" && store != nil {
+		var err error
+		secret, err = store.Get(CredentialKey{Endpoint: config.Endpoint, Username: config.Username, Kind: config.Auth})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("no %s secret found, set %s or save it in credential store", config.Auth, env)
+	}
+
+	if config.Auth == authAccessKey {
+		return jmsh.WithAccessKey(config.AccessKeyID, secret), nil
+	}
+	return jmsh.WithPrivateToken(secret), nil
+}
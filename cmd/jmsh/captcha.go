@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/living42/jmsh"
+	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-tty"
+)
+
+// ways to show captcha, JMSH_CAPTCHA_DISPLAY picks one explicitly
+const (
+	displayKitty  = "kitty"
+	displayITerm  = "iterm"
+	displaySixel  = "sixel"
+	displayBlocks = "blocks"
+	displayASCII  = "ascii"
+	displayFile   = "file"
+)
+
+// resolveCaptcha shows captcha of login page and asks user to interpret
+// it, an empty answer fetches a new one
+func resolveCaptcha(ctx context.Context, lp *jmsh.LoginPage) (string, error) {
+	display := captchaDisplay()
+	for {
+		img, err := lp.FetchCaptchaContext(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintln(os.Stderr, "Captcha founded, please interpret it:")
+		cleanup, err := showCaptcha(display, img)
+		if err != nil {
+			return "", err
+		}
+		answer, err := (&promptui.Prompt{
+			Stdout: promptOutput,
+			Label:  "Captcha (leave empty for a new one)",
+		}).Run()
+		cleanup()
+		if err != nil || strings.TrimSpace(answer) != "" {
+			return strings.TrimSpace(answer), err
+		}
+
+		if err := lp.RefreshCaptchaContext(ctx); err != nil {
+			return "", err
+		}
+	}
+}
+
+// captchaDisplay figures out what graphics the terminal understands
+func captchaDisplay() string {
+	if d := os.Getenv("JMSH_CAPTCHA_DISPLAY"); d != "" {
+		return d
+	}
+	termProgram := os.Getenv("TERM_PROGRAM")
+	term := os.Getenv("TERM")
+	sixel, known := sixelByTerm(term)
+	switch {
+	case termProgram == "iTerm.app" || termProgram == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return displayITerm
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || termProgram == "ghostty":
+		return displayKitty
+	case known && sixel, !known && supportsSixel():
+		return displaySixel
+	case term == "dumb":
+		return displayASCII
+	case utf8Locale():
+		return displayBlocks
+	}
+	return displayASCII
+}
+
+// showCaptcha prints img in the way of display, cleanup should be called
+// once user has answered
+func showCaptcha(display string, img []byte) (cleanup func(), err error) {
+	cleanup = func() {}
+
+	if display == displayITerm {
+		itermImgCat(img)
+		return cleanup, nil
+	}
+	if display == displayFile {
+		return captchaFile(img)
+	}
+
+	m, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		// nothing could be drawn, user may still have a viewer for it
+		return captchaFile(img)
+	}
+
+	switch display {
+	case displayKitty:
+		if !bytes.HasPrefix(img, []byte("\x89PNG")) {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, m); err != nil {
+				return cleanup, err
+			}
+			img = buf.Bytes()
+		}
+		kittyImgCat(img)
+	case displaySixel:
+		if m.Bounds().Dy() < 50 {
+			m = scaleImage(m, m.Bounds().Dx()*2, m.Bounds().Dy()*2)
+		}
+		os.Stderr.WriteString(passthrough(sixelEncode(m)))
+		fmt.Fprintln(os.Stderr)
+	case displayASCII:
+		os.Stderr.WriteString(asciiArt(m, 80))
+	default:
+		os.Stderr.WriteString(halfBlocks(m, 80, truecolor()))
+	}
+	return cleanup, nil
+}
+
+// captchaFile saves img to a temporary file for user to open
+func captchaFile(img []byte) (func(), error) {
+	t, err := ioutil.TempFile("", "jmsh_captcha_*.png")
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	cleanup := func() { os.Remove(t.Name()) }
+
+	if _, err := t.Write(img); err != nil {
+		cleanup()
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "file://%s\n", t.Name())
+	fmt.Fprintln(os.Stderr, "Open another Terminal or press Ctrl-Z to inspect image")
+	return cleanup, nil
+}
+
+// inTmux tells escape sequences have to be passed through tmux
+func inTmux() bool {
+	term := os.Getenv("TERM")
+	return os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen") || strings.HasPrefix(term, "tmux")
+}
+
+// passthrough wraps seq so tmux forwards it to the outer terminal
+func passthrough(seq string) string {
+	if !inTmux() {
+		return seq
+	}
+	return "\x1bPtmux;" + strings.Replace(seq, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+}
+
+func itermImgCat(img []byte) {
+	content := base64.StdEncoding.EncodeToString(img)
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprint(os.Stderr, passthrough("\x1b]1337;File=name=captcha.png;size="+strconv.Itoa(len(img))+";height=4;width=auto;inline=1:"+content+"\x07"))
+	fmt.Fprintln(os.Stderr)
+}
+
+// kittyImgCat draws png with kitty graphics protocol, payload is sent in
+// chunks of 4096 bytes as the protocol requires
+func kittyImgCat(img []byte) {
+	content := base64.StdEncoding.EncodeToString(img)
+
+	var b strings.Builder
+	for first := true; first || content != ""; first = false {
+		chunk := content
+		if len(chunk) > 4096 {
+			chunk = chunk[:4096]
+		}
+		content = content[len(chunk):]
+		more := 0
+		if content != "" {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&b, "\x1b_Ga=T,f=100,r=4,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	os.Stderr.WriteString(passthrough(b.String()))
+	fmt.Fprintln(os.Stderr)
+}
+
+// sixelByTerm tells sixel support from TERM if it's certain, so the
+// terminal needn't be asked
+func sixelByTerm(term string) (sixel, known bool) {
+	switch {
+	case term == "" || term == "dumb" || term == "linux":
+		return false, true
+	case term == "mlterm" || term == "foot" || strings.HasPrefix(term, "foot-") ||
+		strings.HasPrefix(term, "yaft") || strings.HasSuffix(term, "-sixel"):
+		return true, true
+	}
+	return false, false
+}
+
+var (
+	sixelOnce   sync.Once
+	sixelResult bool
+)
+
+// supportsSixel asks terminal for its primary device attributes, sixel
+// capable ones report attribute 4. Terminal is asked once per process
+func supportsSixel() bool {
+	sixelOnce.Do(func() {
+		sixelResult = querySixel()
+	})
+	return sixelResult
+}
+
+func querySixel() bool {
+	t, err := tty.Open()
+	if err != nil {
+		return false
+	}
+	defer t.Close()
+	clean, err := t.Raw()
+	if err != nil {
+		return false
+	}
+	defer clean()
+
+	// terminals not answering at all shouldn't block login
+	in := t.Input()
+	if err := in.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+		return false
+	}
+	if _, err := t.Output().WriteString(passthrough("\x1b[c")); err != nil {
+		return false
+	}
+
+	// reply looks like ESC [ ? 62 ; 4 ; 22 c
+	var reply []byte
+	buf := make([]byte, 64)
+	waited := false
+	for !bytes.HasSuffix(reply, []byte("c")) {
+		n, err := in.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			if waited {
+				return false
+			}
+			// a slow terminal may still answer, which has to be read
+			// here rather than typed into the captcha prompt
+			waited = true
+			if err := in.SetReadDeadline(time.Now().Add(300 * time.Millisecond)); err != nil {
+				return false
+			}
+		}
+	}
+	start := bytes.Index(reply, []byte("\x1b[?"))
+	if start < 0 {
+		return false
+	}
+	for _, attr := range strings.Split(string(reply[start+3:len(reply)-1]), ";") {
+		if attr == "4" {
+			return true
+		}
+	}
+	return false
+}
+
+func utf8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+	// no locale at all is common in containers, modern terminals are
+	// utf-8 anyway
+	return true
+}
+
+func truecolor() bool {
+	ct := os.Getenv("COLORTERM")
+	return ct == "truecolor" || ct == "24bit"
+}
+
+// scaleImage resizes m to w x h, averaging pixels covered by each target
+// pixel, which keeps thin strokes of captcha visible when shrinking
+func scaleImage(m image.Image, w, h int) *image.RGBA {
+	b := m.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.RGBAModel.Convert(m.At(sx, sy)).(color.RGBA)
+					// captcha is drawn on white, so is transparency
+					r += uint32(c.R) + 255 - uint32(c.A)
+					g += uint32(c.G) + 255 - uint32(c.A)
+					bl += uint32(c.B) + 255 - uint32(c.A)
+					n++
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return out
+}
+
+// fitWidth scales m to at most maxWidth pixels wide, keeping aspect ratio
+func fitWidth(m image.Image, maxWidth int) *image.RGBA {
+	w, h := m.Bounds().Dx(), m.Bounds().Dy()
+	if w > maxWidth {
+		h = h * maxWidth / w
+		w = maxWidth
+	}
+	if h < 1 {
+		h = 1
+	}
+	return scaleImage(m, w, h)
+}
+
+// halfBlocks draws m with upper half blocks, each character shows two
+// pixels as its foreground and background colors
+func halfBlocks(m image.Image, maxWidth int, truecolor bool) string {
+	img := fitWidth(m, maxWidth)
+	colorCode := func(c color.RGBA) string {
+		if truecolor {
+			return fmt.Sprintf("2;%d;%d;%d", c.R, c.G, c.B)
+		}
+		return fmt.Sprintf("5;%d", ansi256(c))
+	}
+
+	var b strings.Builder
+	bounds := img.Bounds()
+	for y := 0; y < bounds.Dy(); y += 2 {
+		for x := 0; x < bounds.Dx(); x++ {
+			top := img.RGBAAt(x, y)
+			bottom := color.RGBA{255, 255, 255, 255}
+			if y+1 < bounds.Dy() {
+				bottom = img.RGBAAt(x, y+1)
+			}
+			fmt.Fprintf(&b, "\x1b[38;%sm\x1b[48;%sm▀", colorCode(top), colorCode(bottom))
+		}
+		b.WriteString("\x1b[0m\n")
+	}
+	return b.String()
+}
+
+// ansi256 maps c to the closest color of xterm 256 color palette, grays
+// go to the gray ramp which has finer steps
+func ansi256(c color.RGBA) int {
+	r, g, b := int(c.R), int(c.G), int(c.B)
+	if abs(r-g) < 16 && abs(g-b) < 16 && abs(r-b) < 16 {
+		v := (r + g + b) / 3
+		switch {
+		case v < 8:
+			return 16
+		case v > 238:
+			return 231
+		}
+		return 232 + (v-8)/10
+	}
+	q := func(v int) int { return (v*5 + 127) / 255 }
+	return 16 + 36*q(r) + 6*q(g) + q(b)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// asciiRamp goes from light to dark, captcha is dark text on light
+const asciiRamp = " .:-=+*#%@"
+
+// asciiArt draws m with plain characters, each covers two pixels in height
+func asciiArt(m image.Image, maxWidth int) string {
+	img := fitWidth(m, maxWidth)
+	bounds := img.Bounds()
+
+	var b strings.Builder
+	for y := 0; y < bounds.Dy(); y += 2 {
+		for x := 0; x < bounds.Dx(); x++ {
+			lum := luminance(img.RGBAAt(x, y))
+			if y+1 < bounds.Dy() {
+				lum = (lum + luminance(img.RGBAAt(x, y+1))) / 2
+			}
+			b.WriteByte(asciiRamp[(255-lum)*(len(asciiRamp)-1)/255])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func luminance(c color.RGBA) int {
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
+
+// sixelEncode draws m as sixel graphics with colors quantized to a 6x6x6
+// cube, enough for captcha to stay readable
+func sixelEncode(m image.Image) string {
+	bounds := m.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	level := func(v uint8) int { return (int(v)*5 + 127) / 255 }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\x1bPq\"1;1;%d;%d", w, h)
+	for i := 0; i < 216; i++ {
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+	}
+
+	for y0 := 0; y0 < h; y0 += 6 {
+		// sixel bits of each color used in this band of six rows
+		bands := map[int][]byte{}
+		for x := 0; x < w; x++ {
+			for dy := 0; dy < 6 && y0+dy < h; dy++ {
+				c := color.RGBAModel.Convert(m.At(bounds.Min.X+x, bounds.Min.Y+y0+dy)).(color.RGBA)
+				idx := 36*level(c.R) + 6*level(c.G) + level(c.B)
+				if bands[idx] == nil {
+					bands[idx] = make([]byte, w)
+				}
+				bands[idx][x] |= 1 << uint(dy)
+			}
+		}
+		var colors []int
+		for idx := range bands {
+			colors = append(colors, idx)
+		}
+		sort.Ints(colors)
+
+		for i, idx := range colors {
+			fmt.Fprintf(&b, "#%d", idx)
+			row := bands[idx]
+			for x := 0; x < len(row); {
+				run := 1
+				for x+run < len(row) && row[x+run] == row[x] {
+					run++
+				}
+				ch := row[x] + 63
+				if run > 3 {
+					fmt.Fprintf(&b, "!%d%c", run, ch)
+				} else {
+					b.WriteString(strings.Repeat(string(rune(ch)), run))
+				}
+				x += run
+			}
+			if i < len(colors)-1 {
+				// back to beginning of band for next color
+				b.WriteByte('$')
+			}
+		}
+		b.WriteByte('-')
+	}
+	b.WriteString("\x1b\\")
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// setEnv sets environment variables during test, empty value unsets
+func setEnv(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+// TestCaptchaDisplay covers cases decided without asking the terminal
+func TestCaptchaDisplay(t *testing.T) {
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"JMSH_CAPTCHA_DISPLAY": "file", "TERM": "foot"}, displayFile},
+		{map[string]string{"TERM": "foot"}, displaySixel},
+		{map[string]string{"TERM": "xterm-kitty"}, displayKitty},
+		{map[string]string{"TERM": "dumb"}, displayASCII},
+		{map[string]string{"TERM": "linux", "LANG": "en_US.UTF-8"}, displayBlocks},
+		{map[string]string{"TERM": "linux", "LANG": "C"}, displayASCII},
+	} {
+		t.Run(tc.want, func(t *testing.T) {
+			env := map[string]string{
+				"JMSH_CAPTCHA_DISPLAY": "", "TERM_PROGRAM": "", "LC_TERMINAL": "", "KITTY_WINDOW_ID": "",
+				"LC_ALL": "", "LC_CTYPE": "", "LANG": "",
+			}
+			for k, v := range tc.env {
+				env[k] = v
+			}
+			setEnv(t, env)
+			if got := captchaDisplay(); got != tc.want {
+				t.Errorf("captchaDisplay() with %v = %s, want %s", tc.env, got, tc.want)
+			}
+		})
+	}
+}
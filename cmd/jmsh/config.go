@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// configCommand implements `jmsh config`, settings are fields of Config
+// named as in config.json
+func configCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: jmsh config get [key]           show settings of current profile")
+		fmt.Fprintln(os.Stderr, "       jmsh config set <key> <value>   change a setting, an empty value clears it")
+		fmt.Fprintf(os.Stderr, "\nkeys: %s\n", strings.Join(configKeys(), ", "))
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	profile, config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	switch {
+	case args[0] == "get" && len(args) == 1:
+		for _, key := range configKeys() {
+			if v, _ := getConfig(config, key); v != "" {
+				fmt.Printf("%s = %s\n", key, v)
+			}
+		}
+	case args[0] == "get" && len(args) == 2:
+		v, err := getConfig(config, args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(v)
+	case args[0] == "set" && len(args) == 3:
+		if err := setConfig(&config, args[1], args[2]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := saveConfig(profile, config); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+// configKeys are json names of Config fields
+func configKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+	}
+	return keys
+}
+
+func configField(config *Config, key string) (reflect.Value, error) {
+	for i, k := range configKeys() {
+		if k == key {
+			return reflect.ValueOf(config).Elem().Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown key %s", key)
+}
+
+func getConfig(config Config, key string) (string, error) {
+	f, err := configField(&config, key)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case f.Kind() == reflect.Ptr && f.IsNil():
+		return "", nil
+	case f.Kind() == reflect.Ptr:
+		f = f.Elem()
+	case f.Kind() == reflect.Bool && !f.Bool():
+		// like omitempty in config.json
+		return "", nil
+	}
+	return fmt.Sprint(f.Interface()), nil
+}
+
+func setConfig(config *Config, key, value string) error {
+	f, err := configField(config, key)
+	if err != nil {
+		return err
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b := false
+		if value != "" {
+			if b, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s must be true or false", key)
+			}
+		}
+		f.SetBool(b)
+	case reflect.Ptr:
+		if value == "" {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		f.Set(reflect.ValueOf(&b))
+	}
+
+	if key == "endpoint" {
+		return validateEndpoint(value)
+	}
+	_, err = timeoutOptions(*config)
+	return err
+}
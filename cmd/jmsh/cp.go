@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/living42/jmsh"
+)
+
+// cpCommand implements `jmsh cp`, copies files between local and asset
+func cpCommand(args []string) {
+	fs := flag.NewFlagSet("cp", flag.ExitOnError)
+	recursive := fs.Bool("r", false, "copy directories recursively")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh cp [-r] <local> [user@]host:<path>")
+		fmt.Fprintln(fs.Output(), "       jmsh cp [-r] [user@]host:<path> <local>")
+		fmt.Fprintln(fs.Output(), "\nRemote paths are relative to the SFTP root of the system user.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+
+	srcRemote, dstRemote := parseRemote(src), parseRemote(dst)
+	if (srcRemote == nil) == (dstRemote == nil) {
+		fmt.Println("exactly one of source and destination must be remote")
+		os.Exit(2)
+	}
+	remote := srcRemote
+	if remote == nil {
+		remote = dstRemote
+	}
+
+	c := login()
+
+	asset, err := findAsset(c, remote.hostname)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fm, err := c.OpenFileManager(asset.ID)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer fm.Close()
+
+	root, err := systemUserRoot(fm, remote.user)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	remotePath := root + "/" + remote.path
+
+	if srcRemote != nil {
+		err = download(fm, remotePath, dst, *recursive)
+	} else {
+		err = upload(fm, src, remotePath, *recursive)
+	}
+	if err != nil {
+		fmt.Println(err)
+		fm.Close()
+		os.Exit(1)
+	}
+}
+
+type remoteSpec struct {
+	user     string
+	hostname string
+	path     string
+}
+
+// parseRemote parses [user@]host:path, returns nil for a local path
+func parseRemote(s string) *remoteSpec {
+	idx := strings.Index(s, ":")
+	if idx <= 0 || strings.ContainsRune(s[:idx], '/') {
+		return nil
+	}
+	spec := &remoteSpec{path: s[idx+1:]}
+	spec.user, spec.hostname = parseUserHost(s[:idx])
+	return spec
+}
+
+// remoteFS is what cp needs from jmsh.FileManager
+type remoteFS interface {
+	Stat(p string) (jmsh.FileInfo, error)
+	List(p string) ([]jmsh.FileInfo, error)
+	Mkdir(dir, name string) error
+	Download(p string, offset int64, w io.Writer) (int64, error)
+	Upload(dir, name string, r io.Reader) error
+}
+
+// systemUserRoot finds folder of system user, which is the top level
+// directory in file manager
+func systemUserRoot(fm remoteFS, user string) (string, error) {
+	entries, err := fm.List("/")
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, e := range entries {
+		if user == "" && len(entries) == 1 || e.Name == user {
+			return "/" + e.Name, nil
+		}
+		names = append(names, e.Name)
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no system user found")
+	}
+	return "", fmt.Errorf("no system user found (available option are: %s)", strings.Join(names, ", "))
+}
+
+func download(fm remoteFS, remotePath, localPath string, recursive bool) error {
+	info, err := fm.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(localPath); err == nil && fi.IsDir() {
+		localPath = filepath.Join(localPath, info.Name)
+	}
+
+	if !info.IsDir() {
+		return downloadFile(fm, remotePath, info, localPath)
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (not copied)", remotePath)
+	}
+
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return err
+	}
+	entries, err := fm.List(remotePath)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := download(fm, remotePath+"/"+e.Name, filepath.Join(localPath, e.Name), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadFile writes into a .part file first, an interrupted download
+// resumes from it on next run if the remote file is unchanged
+func downloadFile(fm remoteFS, remotePath string, info jmsh.FileInfo, localPath string) error {
+	partPath := localPath + ".part"
+	f, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && (offset > info.Size || !samePartSource(partPath, info)) {
+		// remote file changed, start over
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if err := writePartSource(partPath, info); err != nil {
+		return err
+	}
+
+	pw := newProgressWriter(f, info.Name, info.Size, offset)
+	if offset < info.Size || info.Size == 0 {
+		_, err = fm.Download(remotePath, offset, pw)
+		pw.Done()
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, localPath); err != nil {
+		return err
+	}
+	return os.Remove(partPath + ".json")
+}
+
+// partSource is size and modification time of the remote file a .part
+// file is downloaded from, kept in <name>.part.json
+type partSource struct {
+	Size int64 `json:"size"`
+	TS   int64 `json:"ts"`
+}
+
+func samePartSource(partPath string, info jmsh.FileInfo) bool {
+	content, err := ioutil.ReadFile(partPath + ".json")
+	if err != nil {
+		return false
+	}
+	var src partSource
+	if err := json.Unmarshal(content, &src); err != nil {
+		return false
+	}
+	return src == partSource{Size: info.Size, TS: info.TS}
+}
+
+func writePartSource(partPath string, info jmsh.FileInfo) error {
+	content, err := json.Marshal(partSource{Size: info.Size, TS: info.TS})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(partPath+".json", content, 0644)
+}
+
+func upload(fm remoteFS, localPath, remotePath string, recursive bool) error {
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	dir, name := path.Dir(remotePath), path.Base(remotePath)
+	if info, err := fm.Stat(remotePath); err == nil && info.IsDir() {
+		dir, name = remotePath, filepath.Base(localPath)
+	}
+
+	if !fi.IsDir() {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		pr := &progressReader{r: f, pw: newProgressWriter(ioutil.Discard, name, fi.Size(), 0)}
+		err = fm.Upload(dir, name, pr)
+		pr.pw.Done()
+		return err
+	}
+	if !recursive {
+		return fmt.Errorf("%s is a directory (not copied)", localPath)
+	}
+
+	if err := fm.Mkdir(dir, name); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(localPath)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := upload(fm, filepath.Join(localPath, e.Name()), dir+"/"+name+"/"+e.Name(), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// progressWriter counts bytes written and reports progress on stderr
+type progressWriter struct {
+	w       io.Writer
+	name    string
+	total   int64
+	written int64
+	last    time.Time
+}
+
+func newProgressWriter(w io.Writer, name string, total, written int64) *progressWriter {
+	return &progressWriter{w: w, name: name, total: total, written: written}
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	if time.Since(pw.last) > 100*time.Millisecond {
+		pw.last = time.Now()
+		pw.print()
+	}
+	return n, err
+}
+
+func (pw *progressWriter) print() {
+	percent := int64(100)
+	if pw.total > 0 {
+		percent = pw.written * 100 / pw.total
+	}
+	fmt.Fprintf(os.Stderr, "\r%-40s %10s / %-10s %3d%%", pw.name, humanSize(pw.written), humanSize(pw.total), percent)
+}
+
+// Done prints final progress and ends the line
+func (pw *progressWriter) Done() {
+	pw.print()
+	fmt.Fprintln(os.Stderr)
+}
+
+type progressReader struct {
+	r  io.Reader
+	pw *progressWriter
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.pw.Write(p[:n])
+	return n, err
+}
+
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
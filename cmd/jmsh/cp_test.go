@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/living42/jmsh"
+)
+
+// memFS is a remoteFS in memory, top level directories are system users
+type memFS struct {
+	files   map[string]*memFile
+	offsets []int64
+	nextTS  int64
+}
+
+type memFile struct {
+	dir     bool
+	content []byte
+	ts      int64
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{"/": {dir: true}, "/root": {dir: true}}}
+}
+
+func (m *memFS) put(p, content string) {
+	for d := path.Dir(p); d != "/"; d = path.Dir(d) {
+		if m.files[d] == nil {
+			m.files[d] = &memFile{dir: true}
+		}
+	}
+	m.nextTS++
+	m.files[p] = &memFile{content: []byte(content), ts: m.nextTS}
+}
+
+func (m *memFS) Stat(p string) (jmsh.FileInfo, error) {
+	p = path.Clean(p)
+	f := m.files[p]
+	if f == nil {
+		return jmsh.FileInfo{}, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	info := jmsh.FileInfo{Name: path.Base(p), Hash: p, Size: int64(len(f.content)), TS: f.ts}
+	if f.dir {
+		info.Mime = "directory"
+	}
+	return info, nil
+}
+
+func (m *memFS) List(p string) ([]jmsh.FileInfo, error) {
+	p = path.Clean(p)
+	var entries []jmsh.FileInfo
+	for name := range m.files {
+		if name != "/" && path.Dir(name) == p {
+			info, _ := m.Stat(name)
+			entries = append(entries, info)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func (m *memFS) Mkdir(dir, name string) error {
+	if _, err := m.Stat(dir); err != nil {
+		return err
+	}
+	p := path.Join(dir, name)
+	if m.files[p] == nil {
+		m.files[p] = &memFile{dir: true}
+	}
+	return nil
+}
+
+func (m *memFS) Download(p string, offset int64, w io.Writer) (int64, error) {
+	f := m.files[path.Clean(p)]
+	if f == nil || f.dir {
+		return 0, fmt.Errorf("%s is not a file", p)
+	}
+	m.offsets = append(m.offsets, offset)
+	n, err := w.Write(f.content[offset:])
+	return int64(n), err
+}
+
+func (m *memFS) Upload(dir, name string, r io.Reader) error {
+	if _, err := m.Stat(dir); err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.put(path.Join(dir, name), string(content))
+	return nil
+}
+
+func readLocal(t *testing.T, p string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestParseRemote(t *testing.T) {
+	for _, tc := range []struct {
+		arg  string
+		want *remoteSpec
+	}{
+		{"node1:logs", &remoteSpec{hostname: "node1", path: "logs"}},
+		{"root@node1:/etc/hosts", &remoteSpec{user: "root", hostname: "node1", path: "/etc/hosts"}},
+		{"./a:b", nil},
+		{":path", nil},
+		{"local", nil},
+	} {
+		got := parseRemote(tc.arg)
+		if (got == nil) != (tc.want == nil) || got != nil && *got != *tc.want {
+			t.Errorf("parseRemote(%q) = %+v, want %+v", tc.arg, got, tc.want)
+		}
+	}
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newMemFS()
+
+	if err := upload(m, filepath.Join(dir, "a.txt"), "/root/b.txt", false); err != nil {
+		t.Fatal(err)
+	}
+	// into an existing directory keeps local name
+	if err := upload(m, filepath.Join(dir, "a.txt"), "/root", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/root/b.txt", "/root/a.txt"} {
+		if f := m.files[p]; f == nil || string(f.content) != "a" {
+			t.Fatalf("expected %s to be uploaded", p)
+		}
+	}
+
+	if err := upload(m, dir, "/root/dir", false); err == nil {
+		t.Fatal("expected directory not copied without -r")
+	}
+}
+
+func TestUploadRecursive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644)
+	m := newMemFS()
+
+	if err := upload(m, dir, "/root", true); err != nil {
+		t.Fatal(err)
+	}
+	if f := m.files["/root/src/sub"]; f == nil || !f.dir {
+		t.Fatal("expected directory to be created")
+	}
+	for p, content := range map[string]string{"/root/src/a.txt": "a", "/root/src/sub/b.txt": "b"} {
+		if f := m.files[p]; f == nil || string(f.content) != content {
+			t.Fatalf("expected %s to be uploaded", p)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	dir := t.TempDir()
+	m := newMemFS()
+	m.put("/root/a.txt", "hello")
+
+	if err := download(m, "/root/a.txt", filepath.Join(dir, "b.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+	// into an existing directory keeps remote name
+	if err := download(m, "/root/a.txt", dir, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if got := readLocal(t, filepath.Join(dir, name)); got != "hello" {
+			t.Fatalf("unexpected content of %s: %q", name, got)
+		}
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*.part*"))
+	if len(left) != 0 {
+		t.Fatalf("expected no partial files left, got %v", left)
+	}
+
+	if err := download(m, "/root", dir, false); err == nil {
+		t.Fatal("expected directory not copied without -r")
+	}
+}
+
+func TestDownloadRecursive(t *testing.T) {
+	dir := t.TempDir()
+	m := newMemFS()
+	m.put("/root/logs/app.log", "app")
+	m.put("/root/logs/old/app.log.1", "old")
+	m.put("/root/logs/empty", "")
+
+	if err := download(m, "/root/logs", dir, true); err != nil {
+		t.Fatal(err)
+	}
+	for p, content := range map[string]string{"logs/app.log": "app", "logs/old/app.log.1": "old", "logs/empty": ""} {
+		if got := readLocal(t, filepath.Join(dir, p)); got != content {
+			t.Fatalf("unexpected content of %s: %q", p, got)
+		}
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "data")
+	m := newMemFS()
+	m.put("/root/data", "0123456789")
+	info, _ := m.Stat("/root/data")
+
+	// interrupted download of the same remote file resumes
+	ioutil.WriteFile(localPath+".part", []byte("0123"), 0644)
+	if err := writePartSource(localPath+".part", info); err != nil {
+		t.Fatal(err)
+	}
+	if err := download(m, "/root/data", localPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLocal(t, localPath); got != "0123456789" || m.offsets[0] != 4 {
+		t.Fatalf("expected resuming from 4, got %q from %v", got, m.offsets)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		source *jmsh.FileInfo
+	}{
+		{"modified", &jmsh.FileInfo{Size: info.Size, TS: info.TS - 1}},
+		{"resized", &jmsh.FileInfo{Size: info.Size + 1, TS: info.TS}},
+		{"unknown source", nil},
+	} {
+		m.offsets = nil
+		os.Remove(localPath)
+		ioutil.WriteFile(localPath+".part", []byte("abcd"), 0644)
+		os.Remove(localPath + ".part.json")
+		if tc.source != nil {
+			writePartSource(localPath+".part", *tc.source)
+		}
+		if err := download(m, "/root/data", localPath, false); err != nil {
+			t.Fatal(err)
+		}
+		if got := readLocal(t, localPath); got != "0123456789" || m.offsets[0] != 0 {
+			t.Fatalf("%s: expected starting over, got %q from %v", tc.name, got, m.offsets)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/living42/jmsh/internal/atomicfile"
+	"github.com/manifoldco/promptui"
+	"golang.org/x/crypto/scrypt"
+)
+
+// CredentialKey identifies a secret of a Jumpserver account
+type CredentialKey struct {
+	Endpoint string
+	Username string
+	// Kind is empty for password, other secrets of the account use their
+	// own kind, e.g. "otp"
+	Kind string
+}
+
+func (k CredentialKey) host() string {
+	u, err := url.Parse(k.Endpoint)
+	if err != nil {
+		return k.Endpoint
+	}
+	return u.Host
+}
+
+// account is how the key shows in backends which have a flat namespace
+func (k CredentialKey) account() string {
+	account := fmt.Sprintf("%s@%s", k.Username, k.host())
+	if k.Kind != "" {
+		account = k.Kind + ":" + account
+	}
+	return account
+}
+
+// CredentialStore keeps secrets outside of config file
+type CredentialStore interface {
+	// Get returns the secret, or empty string if there isn't one
+	Get(key CredentialKey) (string, error)
+	Set(key CredentialKey, secret string) error
+	Delete(key CredentialKey) error
+}
+
+// names of credential store backends, used in config
+const (
+	storeKeychain      = "keychain"
+	storeSecretService = "secret-service"
+	storePass          = "pass"
+	storeHelper        = "helper"
+	storeFile          = "file"
+)
+
+// newCredentialStore creates backend chosen in config
+func newCredentialStore(config Config, configDir string) (CredentialStore, error) {
+	switch config.CredentialStore {
+	case storeKeychain:
+		return keychainStore{}, nil
+	case storeSecretService:
+		return secretServiceStore{}, nil
+	case storePass:
+		return passStore{}, nil
+	case storeHelper:
+		if config.CredentialHelper == "" {
+			return nil, fmt.Errorf("credentialHelper must be set to use helper credential store")
+		}
+		return helperStore{command: config.CredentialHelper}, nil
+	case storeFile:
+		return &fileStore{path: path.Join(configDir, "credentials.enc")}, nil
+	}
+	return nil, fmt.Errorf("unknown credential store %q", config.CredentialStore)
+}
+
+// defaultCredentialStore picks the most suitable backend on this machine
+func defaultCredentialStore() string {
+	if runtime.GOOS == "darwin" {
+		return storeKeychain
+	}
+	if _, err := exec.LookPath("secret-tool"); err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+		return storeSecretService
+	}
+	if _, err := exec.LookPath("pass"); err == nil {
+		home, _ := os.UserHomeDir()
+		if _, err := os.Stat(path.Join(home, ".password-store")); err == nil {
+			return storePass
+		}
+	}
+	return storeFile
+}
+
+// keychainStore uses macOS keychain through security command
+type keychainStore struct{}
+
+func (keychainStore) service(key CredentialKey) string {
+	if key.Kind != "" {
+		return "jmsh " + key.Kind
+	}
+	return "jmsh account"
+}
+
+func (s keychainStore) Get(key CredentialKey) (string, error) {
+	cmd := exec.Command(
+		"security", "find-generic-password",
+		"-a", fmt.Sprintf("%s@%s", key.Username, key.host()),
+		"-c", "jmsh",
+		"-s", s.service(key),
+		"-gw")
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if cmd.ProcessState.ExitCode() == 44 {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (s keychainStore) Set(key CredentialKey, secret string) error {
+	cmd := exec.Command(
+		"security", "add-generic-password",
+		"-a", fmt.Sprintf("%s@%s", key.Username, key.host()),
+		"-c", "jmsh",
+		"-C", "jmsh",
+		"-D", "Jumpserver account for jmsh",
+		"-s", s.service(key),
+		"-w", secret,
+		"-U")
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (s keychainStore) Delete(key CredentialKey) error {
+	cmd := exec.Command(
+		"security", "delete-generic-password",
+		"-a", fmt.Sprintf("%s@%s", key.Username, key.host()),
+		"-c", "jmsh",
+		"-s", s.service(key))
+	if err := cmd.Run(); err != nil && cmd.ProcessState.ExitCode() != 44 {
+		return err
+	}
+	return nil
+}
+
+// secretServiceStore uses freedesktop Secret Service (GNOME Keyring,
+// KWallet, KeePassXC) through secret-tool, which talks D-Bus for us
+type secretServiceStore struct{}
+
+func (secretServiceStore) attrs(key CredentialKey) []string {
+	kind := key.Kind
+	if kind == "" {
+		kind = "password"
+	}
+	return []string{"service", "jmsh", "account", fmt.Sprintf("%s@%s", key.Username, key.host()), "kind", kind}
+}
+
+func (s secretServiceStore) Get(key CredentialKey) (string, error) {
+	cmd := exec.Command("secret-tool", append([]string{"lookup"}, s.attrs(key)...)...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// secret-tool exits with 1 and prints nothing when not found
+		if cmd.ProcessState.ExitCode() == 1 && len(output) == 0 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(string(output), "\n"), nil
+}
+
+func (s secretServiceStore) Set(key CredentialKey, secret string) error {
+	args := append([]string{"store", "--label", "jmsh " + key.account()}, s.attrs(key)...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (s secretServiceStore) Delete(key CredentialKey) error {
+	cmd := exec.Command("secret-tool", append([]string{"clear"}, s.attrs(key)...)...)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// passStore uses pass, the standard unix password manager
+type passStore struct{}
+
+func (passStore) name(key CredentialKey) string {
+	name := path.Join("jmsh", key.host(), key.Username)
+	if key.Kind != "" {
+		name += "." + key.Kind
+	}
+	return name
+}
+
+func (s passStore) Get(key CredentialKey) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("pass", "show", s.name(key))
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(stderr.String(), "is not in the password store") {
+			return "", nil
+		}
+		os.Stderr.Write(stderr.Bytes())
+		return "", err
+	}
+	// like other pass clients, secret is the first line
+	return strings.SplitN(string(output), "\n", 2)[0], nil
+}
+
+func (s passStore) Set(key CredentialKey, secret string) error {
+	cmd := exec.Command("pass", "insert", "--multiline", "--force", s.name(key))
+	cmd.Stdin = strings.NewReader(secret + "\n")
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (s passStore) Delete(key CredentialKey) error {
+	cmd := exec.Command("pass", "rm", "--force", s.name(key))
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// helperStore delegates to an external command speaking git credential
+// helper protocol, it's invoked as `<command> get|store|erase`
+type helperStore struct {
+	command string
+}
+
+func (s helperStore) run(action string, attrs map[string]string) (map[string]string, error) {
+	var input bytes.Buffer
+	for _, k := range []string{"protocol", "host", "path", "username", "password"} {
+		if v, ok := attrs[k]; ok {
+			fmt.Fprintf(&input, "%s=%s\n", k, v)
+		}
+	}
+	input.WriteString("\n")
+
+	cmd := exec.Command("sh", "-c", s.command+" "+action)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s: %s", action, err)
+	}
+
+	result := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if kv := strings.SplitN(scanner.Text(), "=", 2); len(kv) == 2 {
+			result[kv[0]] = kv[1]
+		}
+	}
+	return result, scanner.Err()
+}
+
+func (s helperStore) attrs(key CredentialKey) map[string]string {
+	attrs := map[string]string{"protocol": "https", "host": key.host(), "username": key.Username}
+	if u, err := url.Parse(key.Endpoint); err == nil && u.Scheme != "" {
+		attrs["protocol"] = u.Scheme
+	}
+	if key.Kind != "" {
+		attrs["path"] = key.Kind
+	}
+	return attrs
+}
+
+func (s helperStore) Get(key CredentialKey) (string, error) {
+	result, err := s.run("get", s.attrs(key))
+	if err != nil {
+		return "", err
+	}
+	return result["password"], nil
+}
+
+func (s helperStore) Set(key CredentialKey, secret string) error {
+	attrs := s.attrs(key)
+	attrs["password"] = secret
+	_, err := s.run("store", attrs)
+	return err
+}
+
+func (s helperStore) Delete(key CredentialKey) error {
+	_, err := s.run("erase", s.attrs(key))
+	return err
+}
+
+// fileStore keeps secrets in a local file encrypted with a passphrase,
+// which is read from JMSH_PASSPHRASE or prompted once per run
+type fileStore struct {
+	path       string
+	passphrase string
+}
+
+type encryptedFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// ErrBadPassphrase indicate credentials file can't be decrypted
+var ErrBadPassphrase = errors.New("wrong passphrase for credentials file")
+
+func (s *fileStore) getPassphrase() (string, error) {
+	if s.passphrase != "" {
+		return s.passphrase, nil
+	}
+	if p, ok := os.LookupEnv("JMSH_PASSPHRASE"); ok {
+		s.passphrase = p
+		return p, nil
+	}
+	p, err := (&promptui.Prompt{
+		Stdout: promptOutput,
+		Label:  "Passphrase of credentials file",
+		Mask:   '*',
+	}).Run()
+	if err != nil {
+		return "", err
+	}
+	s.passphrase = p
+	return p, nil
+}
+
+func deriveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *fileStore) load() (map[string]string, error) {
+	secrets := map[string]string{}
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return secrets, nil
+		}
+		return nil, err
+	}
+
+	var f encryptedFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, err
+	}
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := deriveKey(passphrase, f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		s.passphrase = ""
+		return nil, ErrBadPassphrase
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (s *fileStore) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	passphrase, err := s.getPassphrase()
+	if err != nil {
+		return err
+	}
+
+	f := encryptedFile{Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := deriveKey(passphrase, f.Salt)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = aead.Seal(nil, f.Nonce, plain, nil)
+
+	content, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.path, content, 0600)
+}
+
+func (s *fileStore) Get(key CredentialKey) (string, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	return secrets[key.account()], nil
+}
+
+func (s *fileStore) Set(key CredentialKey, secret string) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[key.account()] = secret
+	return s.save(secrets)
+}
+
+func (s *fileStore) Delete(key CredentialKey) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(secrets, key.account())
+	return s.save(secrets)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "jmsh", "credentials.enc")
+	key := CredentialKey{Endpoint: "https://jms.example.com", Username: "admin"}
+	otpKey := CredentialKey{Endpoint: "https://jms.example.com", Username: "admin", Kind: "otp"}
+
+	s := &fileStore{path: p, passphrase: "correct horse"}
+	if secret, err := s.Get(key); err != nil || secret != "" {
+		t.Fatalf("expected no secret before any is set, got %q, %v", secret, err)
+	}
+	if err := s.Set(key, "zeqing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(otpKey, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected credentials file mode 0600, got %o", fi.Mode().Perm())
+	}
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "zeqing") {
+		t.Fatal("secret is stored in clear text")
+	}
+
+	s = &fileStore{path: p, passphrase: "correct horse"}
+	if secret, err := s.Get(key); err != nil || secret != "zeqing" {
+		t.Fatalf("expected secret back, got %q, %v", secret, err)
+	}
+	if err := s.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := s.Get(key); err != nil || secret != "" {
+		t.Fatalf("expected secret deleted, got %q, %v", secret, err)
+	}
+	if secret, err := s.Get(otpKey); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected other secret kept, got %q, %v", secret, err)
+	}
+
+	s = &fileStore{path: p, passphrase: "wrong"}
+	if _, err := s.Get(otpKey); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	if s.passphrase != "" {
+		t.Fatal("expected wrong passphrase forgotten, so it's asked again")
+	}
+}
+
+// credentialHelperScript keeps the secret it's given in a file next to
+// itself, and the input of each action for test to check
+const credentialHelperScript = `#!/bin/sh
+dir=$(dirname "$0")
+cat > "$dir/input.$1"
+case $1 in
+get)
+	echo protocol=https
+	echo username=admin
+	cat "$dir/stored" 2>/dev/null || true
+	;;
+store) grep '^password=' "$dir/input.store" > "$dir/stored" ;;
+erase) rm -f "$dir/stored" ;;
+*) exit 1 ;;
+esac
+`
+
+func TestHelperStore(t *testing.T) {
+	dir := t.TempDir()
+	helper := filepath.Join(dir, "helper")
+	if err := ioutil.WriteFile(helper, []byte(credentialHelperScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+	input := func(action string) string {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "input."+action))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	s := helperStore{command: "'" + helper + "'"}
+	key := CredentialKey{Endpoint: "http://jms.example.com:8080", Username: "admin", Kind: "otp"}
+
+	if secret, err := s.Get(key); err != nil || secret != "" {
+		t.Fatalf("expected no secret before any is stored, got %q, %v", secret, err)
+	}
+	want := "protocol=http\nhost=jms.example.com:8080\npath=otp\nusername=admin\n\n"
+	if got := input("get"); got != want {
+		t.Fatalf("unexpected input of get:\n%q\nwant:\n%q", got, want)
+	}
+
+	if err := s.Set(key, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	want = "protocol=http\nhost=jms.example.com:8080\npath=otp\nusername=admin\npassword=JBSWY3DPEHPK3PXP\n\n"
+	if got := input("store"); got != want {
+		t.Fatalf("unexpected input of store:\n%q\nwant:\n%q", got, want)
+	}
+	if secret, err := s.Get(key); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected stored secret, got %q, %v", secret, err)
+	}
+
+	if err := s.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := s.Get(key); err != nil || secret != "" {
+		t.Fatalf("expected secret erased, got %q, %v", secret, err)
+	}
+
+	s = helperStore{command: "false"}
+	if _, err := s.Get(key); err == nil {
+		t.Fatal("expected failing helper to be an error")
+	}
+}
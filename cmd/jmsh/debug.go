@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/living42/jmsh"
+)
+
+// debugTarget is set by --debug[=FILE] or JMSH_DEBUG, "1" traces into
+// stderr and anything else is a file to append trace to, which keeps it
+// out of terminal sessions
+var debugTarget = os.Getenv("JMSH_DEBUG")
+
+// debugOption enables tracing of client as debugTarget says
+func debugOption() (jmsh.Option, error) {
+	switch debugTarget {
+	case "", "0", "false":
+		return nil, nil
+	case "1", "true", "stderr":
+		return jmsh.WithDebug(os.Stderr), nil
+	}
+	f, err := os.OpenFile(debugTarget, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open debug file: %s", err)
+	}
+	// left open, trace is written until process exits
+	return jmsh.WithDebug(f), nil
+}
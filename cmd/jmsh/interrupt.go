@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// interruptContext is cancelled by the first Ctrl-C, so that pending
+// requests are aborted instead of the whole process being killed. Call
+// stop to restore default handling of Ctrl-C
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-done:
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, func() {
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// lsCommand implements `jmsh ls`, lists assets permitted to user
+func lsCommand(args []string) {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	long := fs.Bool("l", false, "show ip, platform and nodes of assets")
+	nodes := fs.String("nodes", "", "list only assets under node `path`, e.g. /Default/web")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh ls [flags] [keyword]")
+		fmt.Fprintln(fs.Output(), "\nKeyword matches hostname, ip or comment of assets.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c := login()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	it := c.IterAssets(fs.Arg(0))
+	for it.Next() {
+		a := it.Asset()
+		if *nodes != "" && !underNode(a, *nodes) {
+			continue
+		}
+		if *long {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Hostname, a.IP, a.Platform, strings.Join(a.Nodes, ", "))
+		} else {
+			fmt.Fprintln(w, a.Hostname)
+		}
+	}
+	w.Flush()
+	if err := it.Err(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -1,56 +1,105 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
-	"runtime"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/living42/jmsh"
 	"github.com/manifoldco/promptui"
 )
 
-func main() {
-	// TODO save cookies (XDG_CACHE_HOME, $HOME/.cache)
-	// TODO search assets
-	// TODO code organize
-
-	user := ""
-	hostname := ""
-	if len(os.Args) == 2 {
-		arg := os.Args[1]
-		if idx := strings.Index(arg, "@"); idx > 0 {
-			user, hostname = arg[:idx], arg[idx+1:]
-		} else {
-			hostname = arg
-		}
+// command is a subcommand of jmsh
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+// commands returns subcommands in the order shown in help, it's a function
+// as help itself refers to them
+func commands() []command {
+	return []command{
+		{"login", "log in, or check saved session is still valid", loginCommand},
+		{"logout", "end session and forget its cookies", logoutCommand},
+		{"status", "show profile, server and session", statusCommand},
+		{"ls", "list assets", lsCommand},
+		{"ssh", "open a terminal on asset, the default command", sshCommand},
+		{"exec", "run a command on asset", execCommand},
+		{"run", "run a command on many assets", runCommand},
+		{"cp", "copy files between local and asset", cpCommand},
+		{"proxy", "serve assets to plain ssh clients", proxyCommand},
+		{"otp", "manage MFA seed", otpCommand},
+		{"profile", "manage Jumpserver instances", profileCommand},
+		{"config", "get or set settings of current profile", configCommand},
 	}
+}
 
-	home, err := os.UserHomeDir()
-	if err != nil {
-		panic(err)
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: jmsh [-P profile] [--debug[=file]] <command> [args...]")
+	fmt.Fprintln(w, "       jmsh [-P profile] [--debug[=file]] [user@]host [-- command]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(w, "\nglobal flags:")
+	fmt.Fprintln(w, "  -P, --profile <name>   use profile instead of the default one, or set JMSH_PROFILE")
+	fmt.Fprintln(w, "  --debug[=file]         trace requests into stderr or file, or set JMSH_DEBUG")
+	fmt.Fprintln(w, "\nRun 'jmsh <command> -h' for help of a command.")
+}
 
-	xdgHome, ok := os.LookupEnv("XDG_CONFIG_HOME")
-	if !ok {
-		xdgHome = path.Join(home, ".config")
+func main() {
+	os.Args = parseGlobalFlags(os.Args)
+	args := os.Args[1:]
+
+	if len(args) > 0 {
+		for _, cmd := range commands() {
+			if cmd.name == args[0] {
+				cmd.run(args[1:])
+				return
+			}
+		}
+		switch {
+		case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+			usage(os.Stdout)
+			return
+		case strings.HasPrefix(args[0], "-") && args[0] != "--":
+			fmt.Fprintf(os.Stderr, "unknown flag %s\n", args[0])
+			usage(os.Stderr)
+			os.Exit(2)
+		}
 	}
-	configPath := path.Join(xdgHome, "jmsh", "config.json")
 
-	config, err := loadConfig(configPath)
+	// `jmsh [user@]host` is short for `jmsh ssh [user@]host`
+	sshCommand(args)
+}
+
+// promptOutput is where prompts of login flow are shown, login may happen
+// in middle of a command whose stdout is piped, so it's stderr
+var promptOutput io.WriteCloser = nopCloser{os.Stderr}
 
-	// xdgCache, ok := os.LookupEnv("XDG_CACHE_HOME")
-	// if !ok {
-	// 	xdgCache = path.Join(home, ".cache")
-	// }
-	// cookieJarPath := path.Join(xdgCache, "jmsh", "cookies.json")
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// login restores saved session or logs in interactively
+func login() *jmsh.Client {
+	profile, config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	shouldSaveConfig := false
 	shouldSavePassword := false
@@ -58,90 +107,105 @@ func main() {
 
 	if config.Endpoint == "" {
 		config.Endpoint, err = (&promptui.Prompt{
+			Stdout:   promptOutput,
 			Label:    "Endpoint",
 			Validate: validateEndpoint,
 		}).Run()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 		config.Username, err = (&promptui.Prompt{
-			Label: "Username",
+			Stdout: promptOutput,
+			Label:  "Username",
 		}).Run()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 		shouldSaveConfig = true
 	}
 
-	c, err := jmsh.NewClient(config.Endpoint)
+	var store CredentialStore
+	savePassword := config.SavePassword != nil && *config.SavePassword
+	if savePassword && config.CredentialStore == "" {
+		// configs written before credential stores were pluggable
+		config.CredentialStore = storeKeychain
+	}
+	if config.CredentialStore != "" {
+		store, err = newCredentialStore(config, configDir())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	jar, err := jmsh.NewPersistentJar(cookieJarPath(profile))
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	if true {
-		if config.SavePassword != nil && *config.SavePassword {
-			password, err = findPasswordInKeyChain(config.Endpoint, config.Username)
-			if err != nil {
-				fmt.Println(err)
+	var opts []jmsh.Option
+	if config.Auth == "" || config.Auth == authPassword {
+		// long running commands like proxy outlive the session
+		opts = append(opts, jmsh.WithReauthenticate(func(c *jmsh.Client) error {
+			fmt.Fprintln(os.Stderr, "session expired, logging in again")
+			var err error
+			if password == "" && savePassword {
+				password, _ = store.Get(CredentialKey{Endpoint: config.Endpoint, Username: config.Username})
 			}
-		}
-		if password == "" {
-			password, err = (&promptui.Prompt{
-				Label: "Password",
-				Mask:  '*',
-			}).Run()
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+			ctx, stop := interruptContext()
+			defer stop()
+			if password, err = passwordLogin(ctx, c, config, store, password); err != nil {
+				return err
 			}
-		}
+			return jar.Save()
+		}))
+	}
 
-		lp, err := c.FetchLoginPage()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
+	ctx, stop := interruptContext()
+	defer stop()
 
-		captcha := ""
-		if lp.HasCaptcha() {
-			cImg, err := lp.FetchCaptcha()
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
+	c, err := newClient(ctx, config, store, jar, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	loggedIn, err := c.IsLoggedInContext(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !loggedIn && config.Auth != "" && config.Auth != authPassword {
+		fmt.Fprintf(os.Stderr, "authentication with %s failed\n", config.Auth)
+		os.Exit(1)
+	}
 
-			captcha, err = resolveCaptcha(cImg)
+	passwordKey := CredentialKey{Endpoint: config.Endpoint, Username: config.Username}
+
+	if !loggedIn {
+		if savePassword {
+			password, err = store.Get(passwordKey)
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				fmt.Fprintln(os.Stderr, err)
 			}
 		}
-
-		lr, err := lp.Submit(config.Username, password, captcha)
+		password, err = passwordLogin(ctx, c, config, store, password)
 		if err != nil {
-			if lr.HasOTP() {
-				otp, err := (&promptui.Prompt{
-					Label: "OTP",
-				}).Run()
-				if err != nil {
-					fmt.Println(err)
-					os.Exit(1)
-				}
-				if _, err = lr.SubmitOTP(otp); err != nil {
-					fmt.Println(err)
-					os.Exit(1)
-				}
-			} else {
-				fmt.Println(err)
-				os.Exit(1)
-			}
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "login success")
+
+		if err := jar.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 		}
-		fmt.Println("login success")
 
-		if config.SavePassword == nil && runtime.GOOS == "darwin" {
+		if config.SavePassword == nil {
 			result, _ := (&promptui.Prompt{
+				Stdout:    promptOutput,
 				Label:     "Save password",
 				IsConfirm: true,
 			}).Run()
@@ -149,257 +213,244 @@ func main() {
 				y := true
 				config.SavePassword = &y
 				shouldSaveConfig = true
+				if config.CredentialStore == "" {
+					config.CredentialStore = defaultCredentialStore()
+				}
+				store, err = newCredentialStore(config, configDir())
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				fmt.Fprintf(os.Stderr, "password will be saved in %s\n", config.CredentialStore)
 				shouldSavePassword = true
 			}
-		} else if *config.SavePassword {
+		} else if savePassword {
 			shouldSavePassword = true
 		}
 	}
 
 	if shouldSaveConfig {
-		fmt.Println("saving config")
-		if err := saveConfig(configPath, config); err != nil {
-			fmt.Println(err)
+		fmt.Fprintln(os.Stderr, "saving config")
+		if err := saveConfig(profile, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
 	}
 	if shouldSavePassword {
-		if err := addPasswordToKeyChain(config.Endpoint, config.Username, password); err != nil {
-			fmt.Println(err)
+		if err := store.Set(passwordKey, password); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 		}
 	}
 
-	if hostname == "" {
-		hostname, err = (&promptui.Prompt{
-			Label: "Hostname",
-		}).Run()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	}
+	return c
+}
 
-	asset, ok, err := c.FindAssetByHostname(hostname)
+// newClient creates client of Jumpserver in config, using settings in it
+// and cookies in jar. It doesn't log in
+func newClient(ctx context.Context, config Config, store CredentialStore, jar http.CookieJar, extra ...jmsh.Option) (*jmsh.Client, error) {
+	opts := []jmsh.Option{jmsh.WithCookieJar(jar)}
+	timeouts, err := timeoutOptions(config)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
-	if !ok {
-		fmt.Println("no asset found")
-		os.Exit(1)
+	opts = append(opts, timeouts...)
+	transport, err := transportOptions(config)
+	if err != nil {
+		return nil, err
 	}
-	sysUsers, err := c.ListSystemUsers(asset.ID)
+	opts = append(opts, transport...)
+	debug, err := debugOption()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
-	if len(sysUsers) == 0 {
-		fmt.Println("no system user found")
-		os.Exit(1)
+	if debug != nil {
+		opts = append(opts, debug)
 	}
-	var userOpts []string
-	var sysUser *jmsh.SystemUser
-	for _, u := range sysUsers {
-		userOpts = append(userOpts, u.Username)
+	if config.Auth != "" && config.Auth != authPassword {
+		opt, err := tokenAuthOption(config, store)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
 	}
-	if user == "" {
-		if len(sysUsers) > 1 {
-			i, _, err := (&promptui.Select{
-				Label: "Select System User",
-				Items: userOpts,
+	return jmsh.NewClientContext(ctx, config.Endpoint, append(opts, extra...)...)
+}
+
+// passwordLogin logs in with password, asking for it if empty or rejected,
+// and returns the password accepted
+func passwordLogin(ctx context.Context, c *jmsh.Client, config Config, store CredentialStore, password string) (string, error) {
+	var lr *jmsh.LoginResult
+	for attempt := 1; ; attempt++ {
+		if password == "" {
+			var err error
+			password, err = (&promptui.Prompt{
+				Stdout: promptOutput,
+				Label:  "Password",
+				Mask:   '*',
 			}).Run()
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
+				return "", err
 			}
-			sysUser = &sysUsers[i]
-		} else {
-			sysUser = &sysUsers[0]
 		}
-	} else {
-		for _, u := range sysUsers {
-			if u.Username == user {
-				sysUser = &u
-				break
+
+		// fetch again on every attempt, csrf token and captcha are one-off
+		lp, err := c.FetchLoginPageContext(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		captcha := ""
+		if lp.HasCaptcha() {
+			captcha, err = resolveCaptcha(ctx, lp)
+			if err != nil {
+				return "", err
 			}
 		}
-		if sysUser == nil {
-			fmt.Printf("no system user found (available option are: %s)\n", strings.Join(userOpts, ", "))
-			os.Exit(1)
+
+		lr, err = lp.SubmitContext(ctx, config.Username, password, captcha)
+		if err == nil || lr != nil && lr.HasOTP() {
+			break
+		}
+		if attempt == maxLoginAttempts {
+			return "", err
+		}
+		switch {
+		case errors.Is(err, jmsh.ErrBadCredentials):
+			password = ""
+		case errors.Is(err, jmsh.ErrCaptchaInvalid):
+			// keep password, only captcha is asked again
+		default:
+			return "", err
 		}
+		fmt.Fprintln(os.Stderr, err)
 	}
-
-	fmt.Printf("connecting %s@%s\n", sysUser.Username, asset.Hostname)
-
-	if err := c.ConnectAsset(asset.ID, sysUser.ID); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	if lr.HasOTP() {
+		if err := submitOTP(ctx, lr, store, config); err != nil {
+			return "", err
+		}
 	}
+	return password, nil
 }
 
-func validateEndpoint(input string) error {
-	if !strings.HasPrefix(input, "http://") && !strings.HasPrefix(input, "https://") {
-		return fmt.Errorf("must be a http url")
-	}
-	u, err := url.Parse(input)
-	if err != nil {
-		return err
-	}
-	if u.Path != "" {
-		return fmt.Errorf("must not contain path")
+// timeoutOptions applies timeouts in config, which are durations like
+// "10s", empty ones keep defaults of client
+func timeoutOptions(config Config) ([]jmsh.Option, error) {
+	var opts []jmsh.Option
+	if config.ConnectTimeout != "" {
+		d, err := time.ParseDuration(config.ConnectTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connectTimeout: %s", err)
+		}
+		opts = append(opts, jmsh.WithConnectTimeout(d))
 	}
-	return nil
-}
-
-type Config struct {
-	Endpoint     string `json:"endpoint"`
-	Username     string `json:"username"`
-	SavePassword *bool  `json:"savePassword,omitempty"`
-}
-
-func loadConfig(p string) (Config, error) {
-	var config Config
-	content, err := ioutil.ReadFile(p)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return config, nil
+	if config.RequestTimeout != "" {
+		d, err := time.ParseDuration(config.RequestTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid requestTimeout: %s", err)
 		}
-		return config, err
+		opts = append(opts, jmsh.WithRequestTimeout(d))
 	}
-	err = json.Unmarshal(content, &config)
-	return config, err
+	return opts, nil
 }
 
-func saveConfig(p string, config Config) error {
-	renamed := false
-	t, err := ioutil.TempFile(path.Dir(p), "config_*.json")
-	if err != nil {
-		return err
+// transportOptions applies proxy and TLS settings in config
+func transportOptions(config Config) ([]jmsh.Option, error) {
+	var opts []jmsh.Option
+	if config.Proxy != "" {
+		opts = append(opts, jmsh.WithProxy(config.Proxy))
 	}
-	defer func() {
-		t.Close()
-		if !renamed {
-			os.Remove(t.Name())
+	if config.CAFile != "" {
+		opts = append(opts, jmsh.WithCAFile(config.CAFile))
+	}
+	if config.ClientCert != "" || config.ClientKey != "" {
+		if config.ClientCert == "" || config.ClientKey == "" {
+			return nil, fmt.Errorf("clientCert and clientKey must be set together")
 		}
-	}()
-
-	content, err := json.MarshalIndent(&config, "", "  ")
-	if err != nil {
-		return err
+		opts = append(opts, jmsh.WithClientCertificate(config.ClientCert, config.ClientKey))
 	}
-	if _, err := t.Write(content); err != nil {
-		return err
+	if config.InsecureSkipVerify {
+		fmt.Fprintf(os.Stderr, "WARNING: certificate of %s is NOT verified, anyone in between could steal your password and sessions\n", config.Endpoint)
+		opts = append(opts, jmsh.WithInsecureSkipVerify())
 	}
-
-	return os.Rename(t.Name(), p)
+	return opts, nil
 }
 
-func resolveCaptcha(img []byte) (string, error) {
-	if tp, _ := os.LookupEnv("TERM_PROGRAM"); tp == "iTerm.app" {
-		fmt.Printf("Captcha founded, please interpret it:")
-		itermImgCat(img)
-	} else {
-		t, err := ioutil.TempFile("", "jmsh_captcha_*.png")
-		if err != nil {
-			return "", err
-		}
-		defer os.Remove(t.Name())
-		defer t.Close()
+// maxLoginAttempts is how many times user could retry a rejected password,
+// captcha or OTP before giving up
+const maxLoginAttempts = 3
 
-		if _, err := t.Write(img); err != nil {
-			return "", err
-		}
-		if err := t.Sync(); err != nil {
-			return "", err
+func configDir() string {
+	xdgHome, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
 		}
-
-		fmt.Printf("Captcha founded, please interpret it: file://%s\n", t.Name())
-		fmt.Println("Open another Terminal or press Ctrl-Z to inspect image")
+		xdgHome = path.Join(home, ".config")
 	}
+	return path.Join(xdgHome, "jmsh")
+}
 
-	return (&promptui.Prompt{
-		Label: "Captcha",
-	}).Run()
+// profileCacheDir holds cookies of profile, whose name must have passed
+// validateProfileName
+func profileCacheDir(profile string) string {
+	return path.Join(cacheDir(), "profiles", profile)
 }
 
-func itermImgCat(img []byte) {
-	osc := "\x1b]"
-	st := "\x07"
+func cookieJarPath(profile string) string {
+	return path.Join(profileCacheDir(profile), "cookies.json")
+}
 
-	if termEnv, _ := os.LookupEnv("TERM"); strings.HasPrefix(termEnv, "screen") {
-		osc = "\x1bPtmux;\x1b\x1b]"
-		st = "\x07\x1b\\"
+func cacheDir() string {
+	xdgCache, ok := os.LookupEnv("XDG_CACHE_HOME")
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		xdgCache = path.Join(home, ".cache")
 	}
-
-	content := base64.StdEncoding.EncodeToString(img)
-
-	fmt.Println()
-	fmt.Print(osc + "1337;File=name=captcha.png;size=" + strconv.Itoa(len(img)) + ";height=4;width=auto;inline=1:" + content + st)
+	return path.Join(xdgCache, "jmsh")
 }
 
-func addPasswordToKeyChain(endpoint, username, password string) error {
-	u, err := url.Parse(endpoint)
+func validateEndpoint(input string) error {
+	if !strings.HasPrefix(input, "http://") && !strings.HasPrefix(input, "https://") {
+		return fmt.Errorf("must be a http url")
+	}
+	u, err := url.Parse(input)
 	if err != nil {
 		return err
 	}
-	host := u.Host
-
-	cmd := exec.Command(
-		"security", "add-generic-password",
-		"-a", fmt.Sprintf("%s@%s", username, host),
-		"-c", "jmsh",
-		"-C", "jmsh",
-		"-D", "Jumpserver account for jmsh",
-		"-s", "jmsh account",
-		"-w", password,
-		"-U")
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-func findPasswordInKeyChain(endpoint, username string) (string, error) {
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return "", err
-	}
-	host := u.Host
-
-	cmd := exec.Command(
-		"security", "find-generic-password",
-		"-a", fmt.Sprintf("%s@%s", username, host),
-		"-c", "jmsh",
-		"-s", "jmsh account",
-		"-gw")
-	cmd.Stderr = os.Stderr
-	output, err := cmd.Output()
-	if err != nil {
-		if cmd.ProcessState.ExitCode() == 44 {
-			return "", nil
-		}
-		return "", err
+	if u.Path != "" {
+		return fmt.Errorf("must not contain path")
 	}
-
-	return strings.TrimSpace(string(output)), nil
+	return nil
 }
 
-// async function findPasswordInKeyChain(config: Config): Promise<string | null> {
-// 	const host = new URL(config.endpoint).host
-// 	const r = child_process.spawnSync("security", ["find-generic-password", "-a", `${config.username}@${host}`, "-c", "jmsh", "-s", 'jmsh account', "-gw"])
-// 	if (r.status.toString() === '0') {
-// 	  return r.stdout.toString().trim()
-// 	}
-// 	if (r.status.toString() === '44') {
-// 	  return null
-// 	}
-// 	throw new Error(r.stderr.toString())
-//   }
-
-//   async function addPasswordToKeyChain(config: Config, password: string) {
-// 	const host = new URL(config.endpoint).host
-// 	const r = child_process.spawnSync("security", ["add-generic-password", "-a", `${config.username}@${host}`, "-c", "jmsh", "-C", "jmsh", "-D", 'Jumpserver account for jmsh', "-s", 'jmsh account', "-w", password, "-U"])
-// 	if (r.status.toString() === '0') {
-// 	  return
-// 	}
-// 	throw new Error(r.stderr.toString())
-//   }
+type Config struct {
+	Endpoint     string `json:"endpoint"`
+	Username     string `json:"username"`
+	SavePassword *bool  `json:"savePassword,omitempty"`
+	// CredentialStore is backend saving password: keychain, secret-service,
+	// pass, helper or file
+	CredentialStore  string `json:"credentialStore,omitempty"`
+	CredentialHelper string `json:"credentialHelper,omitempty"`
+	// Auth is how to authenticate: password (default), accesskey or token.
+	// Secrets of the latter two come from environment or credential store
+	Auth        string `json:"auth,omitempty"`
+	AccessKeyID string `json:"accessKeyId,omitempty"`
+	// ConnectTimeout and RequestTimeout are durations like "10s", "0s"
+	// disables the limit
+	ConnectTimeout string `json:"connectTimeout,omitempty"`
+	RequestTimeout string `json:"requestTimeout,omitempty"`
+	// Proxy is url of http or socks5 proxy to Jumpserver, HTTP_PROXY and
+	// the like are used if it's empty
+	Proxy string `json:"proxy,omitempty"`
+	// CAFile, ClientCert and ClientKey are paths of PEM files, for
+	// Jumpserver behind an internal PKI
+	CAFile             string `json:"caFile,omitempty"`
+	ClientCert         string `json:"clientCert,omitempty"`
+	ClientKey          string `json:"clientKey,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
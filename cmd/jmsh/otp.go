@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/living42/jmsh"
+	"github.com/manifoldco/promptui"
+)
+
+const otpKind = "otp"
+
+// otpCommand implements `jmsh otp enroll|remove`, manages MFA seed used to
+// generate codes at login
+func otpCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: jmsh otp enroll   save MFA seed (otpauth:// URI or base32 secret)")
+		fmt.Fprintln(os.Stderr, "       jmsh otp remove   forget saved MFA seed")
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		usage()
+	}
+
+	profile, config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if config.Endpoint == "" {
+		fmt.Println("not configured yet, run jmsh to log in first")
+		os.Exit(1)
+	}
+	key := CredentialKey{Endpoint: config.Endpoint, Username: config.Username, Kind: otpKind}
+
+	if config.CredentialStore == "" {
+		config.CredentialStore = defaultCredentialStore()
+		if err := saveConfig(profile, config); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	store, err := newCredentialStore(config, configDir())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "enroll":
+		seed, err := (&promptui.Prompt{
+			Stdout: promptOutput,
+			Label:  "MFA seed",
+			Mask:   '*',
+			Validate: func(input string) error {
+				_, err := jmsh.ParseOTPSecret(input)
+				return err
+			},
+		}).Run()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		secret, _ := jmsh.ParseOTPSecret(seed)
+		if err := store.Set(key, seed); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("MFA seed saved in %s, current code is %s\n", config.CredentialStore, secret.Code(time.Now()))
+	case "remove":
+		if err := store.Delete(key); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+// submitOTP answers OTP step, using code generated from enrolled seed if
+// there is one, otherwise asking user
+func submitOTP(ctx context.Context, lr *jmsh.LoginResult, store CredentialStore, config Config) error {
+	var secret *jmsh.OTPSecret
+	if store != nil {
+		seed, err := store.Get(CredentialKey{Endpoint: config.Endpoint, Username: config.Username, Kind: otpKind})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if seed != "" {
+			if secret, err = jmsh.ParseOTPSecret(seed); err != nil {
+				fmt.Fprintf(os.Stderr, "invalid saved MFA seed: %s\n", err)
+			}
+		}
+	}
+
+	if secret == nil {
+		for attempt := 1; ; attempt++ {
+			otp, err := (&promptui.Prompt{
+				Stdout: promptOutput,
+				Label:  "OTP",
+			}).Run()
+			if err != nil {
+				return err
+			}
+			next, err := lr.SubmitOTPContext(ctx, otp)
+			if err == nil || !errors.Is(err, jmsh.ErrOTPInvalid) || attempt == maxLoginAttempts || !next.HasOTP() {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, err)
+			lr = next
+		}
+	}
+
+	// local clock may lag behind server, then next window is what it expects
+	now := time.Now()
+	lr, err := lr.SubmitOTPContext(ctx, secret.Code(now))
+	if errors.Is(err, jmsh.ErrOTPInvalid) && lr.HasOTP() {
+		_, err = lr.SubmitOTPContext(ctx, secret.Code(now.Add(secret.PeriodDuration())))
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/living42/jmsh"
+	"github.com/manifoldco/promptui"
+)
+
+// pickerItem wraps asset for rendering in picker, system users are fetched
+// in background when the item get highlighted, so a slow or failing asset
+// doesn't freeze the picker
+type pickerItem struct {
+	jmsh.Asset
+	client *jmsh.Client
+
+	mu       sync.Mutex
+	fetching bool
+	// sysUsers is names of system users, or error fetching them
+	sysUsers string
+}
+
+func (it *pickerItem) NodePath() string {
+	return strings.Join(it.Nodes, ", ")
+}
+
+func (it *pickerItem) SystemUsers() string {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.sysUsers != "" {
+		return it.sysUsers
+	}
+	if !it.fetching {
+		it.fetching = true
+		go it.fetchSystemUsers()
+	}
+	return "loading…"
+}
+
+func (it *pickerItem) fetchSystemUsers() {
+	result := "(none)"
+	users, err := it.client.ListSystemUsers(it.ID)
+	if err != nil {
+		result = err.Error()
+	} else if len(users) > 0 {
+		var names []string
+		for _, u := range users {
+			names = append(names, u.Username)
+		}
+		result = strings.Join(names, ", ")
+	}
+	it.mu.Lock()
+	it.sysUsers = result
+	it.mu.Unlock()
+}
+
+// pickAsset lists all assets and let user filter them incrementally
+func pickAsset(c *jmsh.Client) (jmsh.Asset, error) {
+	assets, err := c.SearchAsset("")
+	if err != nil {
+		return jmsh.Asset{}, err
+	}
+	if len(assets) == 0 {
+		return jmsh.Asset{}, fmt.Errorf("no asset found")
+	}
+
+	items := make([]*pickerItem, len(assets))
+	for i, a := range assets {
+		items[i] = &pickerItem{Asset: a, client: c}
+	}
+
+	i, _, err := (&promptui.Select{
+		Stdout: promptOutput,
+		Label:  "Select Asset",
+		Items:  items,
+		Size:   10,
+		Templates: &promptui.SelectTemplates{
+			Label:    "{{ . }}",
+			Active:   "▸ {{ .Hostname | cyan }} {{ .IP | faint }}",
+			Inactive: "  {{ .Hostname }} {{ .IP | faint }}",
+			Selected: "{{ .Hostname }}",
+			Details: `
+Nodes:        {{ .NodePath }}
+System users: {{ .SystemUsers }}`,
+		},
+		Searcher: func(input string, index int) bool {
+			it := items[index]
+			return fuzzyMatch(input, it.Hostname) ||
+				fuzzyMatch(input, it.IP) ||
+				fuzzyMatch(input, it.NodePath())
+		},
+		StartInSearchMode: true,
+	}).Run()
+	if err != nil {
+		return jmsh.Asset{}, err
+	}
+	return assets[i], nil
+}
+
+// fuzzyMatch reports whether all characters of pattern appear in s in order,
+// ignoring case and spaces in pattern
+func fuzzyMatch(pattern, s string) bool {
+	pattern = strings.ToLower(strings.Replace(pattern, " ", "", -1))
+	s = strings.ToLower(s)
+	for _, r := range pattern {
+		idx := strings.IndexRune(s, r)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(string(r)):]
+	}
+	return true
+}
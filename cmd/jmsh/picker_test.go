@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "node1", true},
+		{"node1", "node1", true},
+		{"nd1", "node1", true},
+		{"ND1", "node1", true},
+		{"web 01", "web-01.prod", true},
+		{"172.16", "172.16.222.101", true},
+		{"/def/web", "/Default/web", true},
+		{"1node", "node1", false},
+		{"nodee", "node1", false},
+		{"node1", "", false},
+		{"é", "café", true},
+		{"ée", "café", false},
+	} {
+		if got := fuzzyMatch(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
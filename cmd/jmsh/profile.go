@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/living42/jmsh/internal/atomicfile"
+	"github.com/manifoldco/promptui"
+)
+
+// ConfigFile is content of config.json, holding one Config per Jumpserver
+// instance
+type ConfigFile struct {
+	DefaultProfile string            `json:"defaultProfile,omitempty"`
+	Profiles       map[string]Config `json:"profiles"`
+}
+
+const defaultProfileName = "default"
+
+// selectedProfile is set by -P/--profile or JMSH_PROFILE
+var selectedProfile = os.Getenv("JMSH_PROFILE")
+
+// parseGlobalFlags consumes flags valid before any subcommand and returns
+// remaining arguments
+func parseGlobalFlags(args []string) []string {
+	rest := []string{args[0]}
+	i := 1
+loop:
+	for ; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-P" || arg == "--profile":
+			if i+1 >= len(args) {
+				fmt.Printf("%s requires a profile name\n", arg)
+				os.Exit(2)
+			}
+			i++
+			selectedProfile = args[i]
+		case strings.HasPrefix(arg, "--profile="):
+			selectedProfile = strings.TrimPrefix(arg, "--profile=")
+		case arg == "--debug":
+			debugTarget = "1"
+		case strings.HasPrefix(arg, "--debug="):
+			debugTarget = strings.TrimPrefix(arg, "--debug=")
+		default:
+			break loop
+		}
+	}
+	if selectedProfile != "" {
+		if err := validateProfileName(selectedProfile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	return append(rest, args[i:]...)
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validateProfileName rejects names unsafe to be part of a path, profile
+// name is used as directory of its cookies
+func validateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name %q, use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+func configFilePath() string {
+	return path.Join(configDir(), "config.json")
+}
+
+func loadConfigFile() (ConfigFile, error) {
+	f := ConfigFile{Profiles: map[string]Config{}}
+	content, err := ioutil.ReadFile(configFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return f, err
+	}
+	if err := json.Unmarshal(content, &f); err != nil {
+		return f, err
+	}
+	if f.Profiles == nil {
+		f.Profiles = map[string]Config{}
+	}
+
+	if len(f.Profiles) == 0 {
+		// config written before profiles existed holds a single Config
+		var legacy Config
+		if err := json.Unmarshal(content, &legacy); err != nil {
+			return f, err
+		}
+		if legacy.Endpoint != "" {
+			f.Profiles[defaultProfileName] = legacy
+			f.DefaultProfile = defaultProfileName
+		}
+	}
+	return f, nil
+}
+
+func saveConfigFile(f ConfigFile) error {
+	content, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(configFilePath(), content, 0600)
+}
+
+// currentProfile is profile chosen on command line, or the default one
+func (f ConfigFile) currentProfile() (string, error) {
+	name := defaultProfileName
+	switch {
+	case selectedProfile != "":
+		name = selectedProfile
+	case f.DefaultProfile != "":
+		name = f.DefaultProfile
+	}
+	return name, validateProfileName(name)
+}
+
+// loadConfig returns current profile and its config, config is empty if
+// profile doesn't exist yet
+func loadConfig() (string, Config, error) {
+	f, err := loadConfigFile()
+	if err != nil {
+		return "", Config{}, err
+	}
+	name, err := f.currentProfile()
+	if err != nil {
+		return "", Config{}, err
+	}
+	return name, f.Profiles[name], nil
+}
+
+// saveConfig stores config as profile name, the first profile saved
+// becomes the default
+func saveConfig(name string, config Config) error {
+	f, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	f.Profiles[name] = config
+	if f.DefaultProfile == "" {
+		f.DefaultProfile = name
+	}
+	return saveConfigFile(f)
+}
+
+// profileCommand implements `jmsh profile`
+func profileCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: jmsh profile list             list profiles, default one is marked with *")
+		fmt.Fprintln(os.Stderr, "       jmsh profile add <name>       add a Jumpserver instance")
+		fmt.Fprintln(os.Stderr, "       jmsh profile remove <name>    remove profile and its cookies")
+		fmt.Fprintln(os.Stderr, "       jmsh profile default <name>   use profile when -P is not given")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	f, err := loadConfigFile()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if len(args) == 2 {
+		if err := validateProfileName(args[1]); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		var names []string
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			mark := " "
+			if name == f.DefaultProfile {
+				mark = "*"
+			}
+			p := f.Profiles[name]
+			fmt.Printf("%s %-12s %s@%s\n", mark, name, p.Username, p.Endpoint)
+		}
+	case args[0] == "add" && len(args) == 2:
+		name := args[1]
+		if _, ok := f.Profiles[name]; ok {
+			fmt.Printf("profile %s already exists\n", name)
+			os.Exit(1)
+		}
+		var config Config
+		config.Endpoint, err = (&promptui.Prompt{
+			Stdout:   promptOutput,
+			Label:    "Endpoint",
+			Validate: validateEndpoint,
+		}).Run()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		config.Username, err = (&promptui.Prompt{
+			Stdout: promptOutput,
+			Label:  "Username",
+		}).Run()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := saveConfig(name, config); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case args[0] == "remove" && len(args) == 2:
+		name := args[1]
+		if _, ok := f.Profiles[name]; !ok {
+			fmt.Printf("no such profile %s\n", name)
+			os.Exit(1)
+		}
+		delete(f.Profiles, name)
+		if f.DefaultProfile == name {
+			f.DefaultProfile = ""
+		}
+		if err := saveConfigFile(f); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := os.RemoveAll(profileCacheDir(name)); err != nil {
+			fmt.Println(err)
+		}
+	case args[0] == "default" && len(args) == 2:
+		name := args[1]
+		if _, ok := f.Profiles[name]; !ok {
+			fmt.Printf("no such profile %s\n", name)
+			os.Exit(1)
+		}
+		f.DefaultProfile = name
+		if err := saveConfigFile(f); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// withConfigDir points config dir of jmsh to a temporary one during test
+func withConfigDir(t *testing.T) string {
+	dir := t.TempDir()
+	old, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", old)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	})
+	return path.Join(dir, "jmsh")
+}
+
+func TestValidateProfileName(t *testing.T) {
+	for _, name := range []string{"default", "prod-1", "jms.example_com"} {
+		if err := validateProfileName(name); err != nil {
+			t.Errorf("expected %q valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../../..", "a/b", "/etc", "a b"} {
+		if err := validateProfileName(name); err == nil {
+			t.Errorf("expected %q invalid", name)
+		}
+	}
+
+	old := selectedProfile
+	defer func() { selectedProfile = old }()
+	selectedProfile = ""
+	if _, err := (ConfigFile{DefaultProfile: "../.."}).currentProfile(); err == nil {
+		t.Error("expected invalid default profile rejected")
+	}
+}
+
+func TestLoadLegacyConfig(t *testing.T) {
+	dir := withConfigDir(t)
+	old := selectedProfile
+	defer func() { selectedProfile = old }()
+	selectedProfile = ""
+
+	legacy := `{"endpoint":"https://jms.example.com","username":"admin","savePassword":true}`
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "config.json"), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	name, config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != defaultProfileName || config.Endpoint != "https://jms.example.com" ||
+		config.Username != "admin" || config.SavePassword == nil || !*config.SavePassword {
+		t.Fatalf("unexpected migrated config %s %+v", name, config)
+	}
+
+	// saving writes profiles format, which loads the same
+	if err := saveConfig(name, config); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f ConfigFile
+	if err := json.Unmarshal(content, &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.DefaultProfile != defaultProfileName || f.Profiles[defaultProfileName].Endpoint != "https://jms.example.com" {
+		t.Fatalf("unexpected saved config %s", content)
+	}
+	if _, config2, err := loadConfig(); err != nil || config2.Username != "admin" {
+		t.Fatalf("failed to load saved config: %+v %v", config2, err)
+	}
+}
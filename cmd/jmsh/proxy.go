@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/living42/jmsh"
+	"github.com/living42/jmsh/internal/atomicfile"
+	"golang.org/x/crypto/ssh"
+)
+
+// proxyCommand implements `jmsh proxy`, a local SSH server which forwards
+// sessions to assets, so plain ssh and tools built on it work through
+// Jumpserver:
+//
+//	ssh -p 2222 root@node1@127.0.0.1
+//
+// Only shell and exec sessions are supported, koko terminals can't carry
+// sftp or port forwarding. Exec commands don't get stdin either, so those
+// which need it, like scp and rsync, are refused
+func proxyCommand(args []string) {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:2222", "`address` to listen on")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh proxy [flags]")
+		fmt.Fprintln(fs.Output(), "\nThen connect with: ssh -p 2222 [user@]host@127.0.0.1")
+		fmt.Fprintln(fs.Output(), "Keys in ~/.ssh/authorized_keys and ~/.ssh/*.pub are accepted.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+
+	hostKey, err := loadHostKey(path.Join(configDir(), "ssh_host_key"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	allowed, err := loadAllowedKeys(home)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(allowed) == 0 {
+		fmt.Println("no public key found in ~/.ssh, nobody could log in")
+		os.Exit(1)
+	}
+
+	c := login()
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, k := range allowed {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown public key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "listening on %s\n", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		go serveSSH(c, config, conn)
+	}
+}
+
+func serveSSH(c *jmsh.Client, config *ssh.ServerConfig, conn net.Conn) {
+	defer conn.Close()
+
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", conn.RemoteAddr(), err)
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	// ssh user is [user@]host, host part of it is the asset
+	user, hostname := "", sconn.User()
+	if idx := strings.LastIndex(hostname, "@"); idx > 0 {
+		user, hostname = hostname[:idx], hostname[idx+1:]
+	}
+
+	var (
+		asset   jmsh.Asset
+		sysUser *jmsh.SystemUser
+	)
+	asset, ok, err := c.FindAssetByHostname(hostname)
+	if err == nil && !ok {
+		err = fmt.Errorf("no asset found")
+	}
+	if err == nil {
+		sysUser, err = findSystemUser(c, asset, user)
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s@%s\n", conn.RemoteAddr(), user, hostname)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only session is supported")
+			continue
+		}
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSession(c, asset, sysUser, ch, chReqs)
+	}
+}
+
+func serveSession(c *jmsh.Client, asset jmsh.Asset, sysUser *jmsh.SystemUser, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	size := jmsh.WindowSize{Cols: 80, Rows: 24}
+	resize := make(chan jmsh.WindowSize, 1)
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var p struct {
+				Term          string
+				Cols, Rows    uint32
+				Width, Height uint32
+				Modes         string
+			}
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			size = jmsh.WindowSize{Cols: int(p.Cols), Rows: int(p.Rows)}
+			req.Reply(true, nil)
+		case "window-change":
+			var p struct {
+				Cols, Rows    uint32
+				Width, Height uint32
+			}
+			if err := ssh.Unmarshal(req.Payload, &p); err == nil {
+				select {
+				case resize <- jmsh.WindowSize{Cols: int(p.Cols), Rows: int(p.Rows)}:
+				default:
+				}
+			}
+		case "env":
+			req.Reply(true, nil)
+		case "shell":
+			req.Reply(true, nil)
+			// keep serving window-change while terminal is attached
+			go func() {
+				status := uint32(0)
+				if err := c.AttachTerminal(asset.ID, sysUser.ID, size, resize, ch, ch); err != nil {
+					fmt.Fprintln(ch.Stderr(), err)
+					status = 255
+				}
+				sendExitStatus(ch, status)
+				ch.Close()
+			}()
+		case "exec":
+			var p struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			if reason := needsStdin(p.Command); reason != "" {
+				req.Reply(true, nil)
+				fmt.Fprintf(ch.Stderr(), "jmsh proxy: %s needs stdin, which is not forwarded to commands on assets, use jmsh cp to copy files\n", reason)
+				sendExitStatus(ch, 255)
+				return
+			}
+			req.Reply(true, nil)
+			go discardStdin(ch)
+			go func() {
+				status, err := c.ExecAsset(asset.ID, sysUser.ID, p.Command, ch)
+				if err != nil {
+					fmt.Fprintln(ch.Stderr(), err)
+					status = 255
+				}
+				sendExitStatus(ch, uint32(status))
+				ch.Close()
+			}()
+		case "subsystem":
+			var p struct{ Name string }
+			ssh.Unmarshal(req.Payload, &p)
+			req.Reply(false, nil)
+			fmt.Fprintf(ch.Stderr(), "jmsh proxy: subsystem %s is not supported, use jmsh cp to copy files\n", p.Name)
+			sendExitStatus(ch, 255)
+			return
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// needsStdin tells which part of command talks over stdin, commands on
+// assets run with stdin from /dev/null
+func needsStdin(command string) string {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return ""
+	}
+	switch path.Base(args[0]) {
+	case "scp":
+		// remote end of scp is "scp [-prv] -t|-f [--] path"
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.ContainsAny(arg, "tf") {
+				return "scp"
+			}
+		}
+	case "rsync":
+		for _, arg := range args[1:] {
+			if arg == "--server" {
+				return "rsync --server"
+			}
+		}
+	}
+	return ""
+}
+
+// discardStdin reads away what client sends to an exec session, and
+// warns once that it's lost
+func discardStdin(ch ssh.Channel) {
+	buf := make([]byte, 32<<10)
+	warned := false
+	for {
+		n, err := ch.Read(buf)
+		if n > 0 && !warned {
+			fmt.Fprintln(ch.Stderr(), "jmsh proxy: stdin is not forwarded to commands on assets, it's discarded")
+			warned = true
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func sendExitStatus(ch ssh.Channel, status uint32) {
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
+
+// loadHostKey reads host key at p, generates one on first use
+func loadHostKey(p string) (ssh.Signer, error) {
+	content, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		content = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		if err := atomicfile.WriteFile(p, content, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(content)
+}
+
+// loadAllowedKeys collects user's own public keys
+func loadAllowedKeys(home string) ([]ssh.PublicKey, error) {
+	files, err := filepath.Glob(filepath.Join(home, ".ssh", "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, filepath.Join(home, ".ssh", "authorized_keys"))
+
+	var keys []ssh.PublicKey
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for len(content) > 0 {
+			key, _, _, rest, err := ssh.ParseAuthorizedKey(content)
+			if err != nil {
+				break
+			}
+			keys = append(keys, key)
+			content = rest
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestNeedsStdin(t *testing.T) {
+	for command, want := range map[string]string{
+		"scp -t -- /tmp":                          "scp",
+		"scp -p -f /etc/hosts":                    "scp",
+		"/usr/bin/scp -prt /tmp":                  "scp",
+		"rsync --server -vlogDtpre.iLsfxC . /tmp": "rsync --server",
+		"uptime":          "",
+		"rsync --version": "",
+		"":                "",
+	} {
+		if got := needsStdin(command); got != want {
+			t.Errorf("needsStdin(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/living42/jmsh"
+)
+
+// runCommand implements `jmsh run`, executes one command on many assets
+func runCommand(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	nodes := fs.String("nodes", "", "run on assets under node `path`, e.g. /Default/web")
+	match := fs.String("match", "", "run on assets whose hostname or ip matches glob `pattern`")
+	user := fs.String("user", "", "system `username` to use, required when asset has several")
+	parallel := fs.Int("parallel", 8, "max number of concurrent connections")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh run (--nodes <node-path> | --match <pattern>) [flags] -- cmd [args...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	command := strings.Join(fs.Args(), " ")
+	if command == "" || (*nodes == "" && *match == "") || *parallel < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c := login()
+
+	all, err := c.SearchAsset("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var assets []jmsh.Asset
+	for _, a := range all {
+		if *nodes != "" && !underNode(a, *nodes) {
+			continue
+		}
+		if *match != "" && !globMatch(*match, a.Hostname) && !globMatch(*match, a.IP) {
+			continue
+		}
+		assets = append(assets, a)
+	}
+	if len(assets) == 0 {
+		fmt.Fprintln(os.Stderr, "no asset found")
+		os.Exit(1)
+	}
+
+	width := 0
+	for _, a := range assets {
+		if len(a.Hostname) > width {
+			width = len(a.Hostname)
+		}
+	}
+
+	stdout := &syncWriter{w: os.Stdout}
+	results := make([]string, len(assets))
+	failed := false
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				a := assets[i]
+				out := &prefixWriter{prefix: fmt.Sprintf("%-*s | ", width, a.Hostname), w: stdout}
+				status, err := runOnAsset(c, a, *user, command, out)
+				out.Flush()
+				switch {
+				case err != nil:
+					results[i] = "error: " + err.Error()
+				case status != 0:
+					results[i] = fmt.Sprintf("exit %d", status)
+				default:
+					results[i] = "ok"
+				}
+			}
+		}()
+	}
+	for i := range assets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Fprintln(os.Stderr)
+	for i, a := range assets {
+		if results[i] != "ok" {
+			failed = true
+		}
+		fmt.Fprintf(os.Stderr, "%-*s  %s\n", width, a.Hostname, results[i])
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runOnAsset(c *jmsh.Client, asset jmsh.Asset, user, command string, out io.Writer) (int, error) {
+	sysUser, err := findSystemUser(c, asset, user)
+	if err != nil {
+		return -1, err
+	}
+	return c.ExecAsset(asset.ID, sysUser.ID, command, out)
+}
+
+// findSystemUser picks system user by username, user may be empty when
+// asset has only one system user
+func findSystemUser(c *jmsh.Client, asset jmsh.Asset, user string) (*jmsh.SystemUser, error) {
+	sysUsers, err := c.ListSystemUsers(asset.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, u := range sysUsers {
+		if user == "" && len(sysUsers) == 1 || u.Username == user {
+			return &sysUsers[i], nil
+		}
+	}
+
+	var userOpts []string
+	for _, u := range sysUsers {
+		userOpts = append(userOpts, u.Username)
+	}
+	return nil, fmt.Errorf("no system user found (available option are: %s)", strings.Join(userOpts, ", "))
+}
+
+// underNode reports whether asset belongs to node p or any of its children
+func underNode(a jmsh.Asset, p string) bool {
+	p = strings.TrimSuffix(p, "/")
+	for _, n := range a.Nodes {
+		if n == p || strings.HasPrefix(n, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func globMatch(pattern, s string) bool {
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
+}
+
+// prefixWriter prefixes every line, lines are written whole so outputs of
+// concurrent commands don't interleave in middle of line
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	var lines []byte
+	for {
+		idx := bytes.IndexByte(pw.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		lines = append(lines, pw.prefix...)
+		lines = append(lines, pw.buf[:idx+1]...)
+		pw.buf = pw.buf[idx+1:]
+	}
+	if len(lines) > 0 {
+		if _, err := pw.w.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes pending incomplete line
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	_, err := pw.Write([]byte("\n"))
+	return err
+}
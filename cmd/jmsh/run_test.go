@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/living42/jmsh"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		writes []string
+		// before is output before Flush, want is output after it
+		before, want string
+	}{
+		{"nothing", nil, "", ""},
+		{"one line", []string{"a\n"}, "h | a\n", "h | a\n"},
+		{"lines in one write", []string{"a\nb\n"}, "h | a\nh | b\n", "h | a\nh | b\n"},
+		{"line split across writes", []string{"a", "b", "c\n"}, "h | abc\n", "h | abc\n"},
+		{"partial line held", []string{"a\nb"}, "h | a\n", "h | a\nh | b\n"},
+		{"empty lines", []string{"\n\n"}, "h | \nh | \n", "h | \nh | \n"},
+		{"only partial", []string{"no newline"}, "", "h | no newline\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			pw := &prefixWriter{prefix: "h | ", w: &out}
+			for _, w := range tc.writes {
+				n, err := pw.Write([]byte(w))
+				if err != nil || n != len(w) {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if out.String() != tc.before {
+				t.Fatalf("before Flush got %q, want %q", out.String(), tc.before)
+			}
+			if err := pw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.want {
+				t.Fatalf("after Flush got %q, want %q", out.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestUnderNode(t *testing.T) {
+	a := jmsh.Asset{Nodes: []string{"/Default/web/prod", "/Ops"}}
+	for _, tc := range []struct {
+		node string
+		want bool
+	}{
+		{"/Default", true},
+		{"/Default/", true},
+		{"/Default/web", true},
+		{"/Default/web/prod", true},
+		{"/Ops", true},
+		{"/Default/we", false},
+		{"/Default/web/prod/a", false},
+		{"/Op", false},
+	} {
+		if got := underNode(a, tc.node); got != tc.want {
+			t.Errorf("underNode(%v, %q) = %v, want %v", a.Nodes, tc.node, got, tc.want)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"web-*", "web-01", true},
+		{"web-??", "web-01", true},
+		{"web-[0-9]*", "web-01", true},
+		{"172.16.*", "172.16.222.101", true},
+		{"web-*", "db-01", false},
+		{"web", "web-01", false},
+		{"[", "web", false},
+	} {
+		if got := globMatch(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/living42/jmsh"
+)
+
+// loginCommand implements `jmsh login`
+func loginCommand(args []string) {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh login")
+		fmt.Fprintln(fs.Output(), "\nLogs in to Jumpserver of current profile, asking for endpoint and username")
+		fmt.Fprintln(fs.Output(), "if it's new. Nothing is asked while saved session is still valid.")
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	login()
+
+	profile, config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("logged in %s as %s (profile %s)\n", config.Endpoint, config.Username, profile)
+}
+
+// logoutCommand implements `jmsh logout`
+func logoutCommand(args []string) {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh logout")
+		fmt.Fprintln(fs.Output(), "\nEnds session on Jumpserver and removes its cookies. Saved password and")
+		fmt.Fprintln(fs.Output(), "MFA seed are kept, remove them with your credential store.")
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	profile, config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	jarPath := cookieJarPath(profile)
+	if _, err := os.Stat(jarPath); os.IsNotExist(err) {
+		fmt.Println("not logged in")
+		return
+	}
+
+	// tokens and access keys have no session to end
+	if config.Endpoint != "" && (config.Auth == "" || config.Auth == authPassword) {
+		if err := endSession(config, jarPath); err != nil {
+			fmt.Printf("failed to end session on Jumpserver: %s\n", err)
+		}
+	}
+	if err := os.Remove(jarPath); err != nil && !os.IsNotExist(err) {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("logged out")
+}
+
+func endSession(config Config, jarPath string) error {
+	jar, err := jmsh.NewPersistentJar(jarPath)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	c, err := newClient(ctx, config, nil, jar)
+	if err != nil {
+		return err
+	}
+	return c.LogoutContext(ctx)
+}
+
+// statusCommand implements `jmsh status`, it exits with 1 if not logged in
+func statusCommand(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh status")
+		fmt.Fprintln(fs.Output(), "\nShows current profile and whether its session is valid, exit status is 1")
+		fmt.Fprintln(fs.Output(), "if it's not.")
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	profile, config, err := loadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("profile:  %s\n", profile)
+	if config.Endpoint == "" {
+		fmt.Println("not configured, run 'jmsh login' to set it up")
+		os.Exit(1)
+	}
+	auth := config.Auth
+	if auth == "" {
+		auth = authPassword
+	}
+	fmt.Printf("endpoint: %s\n", config.Endpoint)
+	fmt.Printf("username: %s\n", config.Username)
+	fmt.Printf("auth:     %s\n", auth)
+
+	var store CredentialStore
+	if config.CredentialStore != "" {
+		if store, err = newCredentialStore(config, configDir()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	jar, err := jmsh.NewPersistentJar(cookieJarPath(profile))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	c, err := newClient(ctx, config, store, jar)
+	if err != nil {
+		fmt.Printf("server:   %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("server:   Jumpserver %s\n", c.ServerVersion())
+
+	loggedIn, err := c.IsLoggedInContext(ctx)
+	switch {
+	case err != nil:
+		fmt.Printf("session:  %s\n", err)
+		os.Exit(1)
+	case !loggedIn:
+		fmt.Println("session:  not logged in")
+		os.Exit(1)
+	}
+	fmt.Println("session:  logged in")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/living42/jmsh"
+	"github.com/manifoldco/promptui"
+)
+
+// sshCommand implements `jmsh ssh`, opens a terminal on asset, or runs a
+// command on it if one follows --
+func sshCommand(args []string) {
+	fs := flag.NewFlagSet("ssh", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh ssh [[user@]host] [-- command]")
+		fmt.Fprintln(fs.Output(), "\nWithout host, assets are listed to pick from. Without user, system user")
+		fmt.Fprintln(fs.Output(), "is asked when asset has several, or required with a command. 'ssh' may")
+		fmt.Fprintln(fs.Output(), "be omitted.")
+	}
+	command := ""
+	for i, arg := range args {
+		if arg == "--" {
+			command = strings.Join(args[i+1:], " ")
+			args = args[:i]
+			break
+		}
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	user, hostname := parseUserHost(fs.Arg(0))
+	if command != "" {
+		if hostname == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		execOnHost(user, hostname, command)
+	}
+
+	c := login()
+
+	var (
+		asset jmsh.Asset
+		err   error
+	)
+	if hostname == "" {
+		asset, err = pickAsset(c)
+	} else {
+		asset, err = findAsset(c, hostname)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sysUser, err := selectSystemUser(c, asset, user)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("connecting %s@%s\n", sysUser.Username, asset.Hostname)
+
+	if err := c.ConnectAsset(asset.ID, sysUser.ID); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// execCommand implements `jmsh exec`, runs a command on asset without
+// asking anything, and exits with its status
+func execCommand(args []string) {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jmsh exec [user@]host [--] command [args...]")
+		fmt.Fprintln(fs.Output(), "\nUser is required when asset has several system users. Exit status is")
+		fmt.Fprintln(fs.Output(), "that of command, or 255 if it couldn't run.")
+	}
+	fs.Parse(args)
+	rest := fs.Args()
+	if len(rest) > 1 && rest[1] == "--" {
+		rest = append(rest[:1], rest[2:]...)
+	}
+	if len(rest) < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	user, hostname := parseUserHost(rest[0])
+	execOnHost(user, hostname, strings.Join(rest[1:], " "))
+}
+
+// execOnHost runs command on asset without asking anything and exits
+// with its status, or 255 with error on stderr if it couldn't run, as
+// ssh does
+func execOnHost(user, hostname, command string) {
+	c := login()
+
+	asset, err := findAsset(c, hostname)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(255)
+	}
+	status, err := runOnAsset(c, asset, user, command, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(255)
+	}
+	os.Exit(status)
+}
+
+// parseUserHost splits [user@]host
+func parseUserHost(arg string) (user, hostname string) {
+	if idx := strings.Index(arg, "@"); idx > 0 {
+		return arg[:idx], arg[idx+1:]
+	}
+	return "", arg
+}
+
+// findAsset looks up asset by exact hostname
+func findAsset(c *jmsh.Client, hostname string) (jmsh.Asset, error) {
+	asset, ok, err := c.FindAssetByHostname(hostname)
+	if err != nil {
+		return jmsh.Asset{}, err
+	}
+	if !ok {
+		return jmsh.Asset{}, fmt.Errorf("no asset found")
+	}
+	return asset, nil
+}
+
+// selectSystemUser picks system user by username, asking user to choose
+// when username is empty and asset has several
+func selectSystemUser(c *jmsh.Client, asset jmsh.Asset, user string) (*jmsh.SystemUser, error) {
+	if user != "" {
+		return findSystemUser(c, asset, user)
+	}
+
+	sysUsers, err := c.ListSystemUsers(asset.ID)
+	if err != nil {
+		return nil, err
+	}
+	switch len(sysUsers) {
+	case 0:
+		return nil, fmt.Errorf("no system user found")
+	case 1:
+		return &sysUsers[0], nil
+	}
+	var userOpts []string
+	for _, u := range sysUsers {
+		userOpts = append(userOpts, u.Username)
+	}
+	i, _, err := (&promptui.Select{
+		Stdout: promptOutput,
+		Label:  "Select System User",
+		Items:  userOpts,
+	}).Run()
+	if err != nil {
+		return nil, err
+	}
+	return &sysUsers[i], nil
+}
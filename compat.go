@@ -0,0 +1,333 @@
+package jmsh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// serverAPI is the part of Jumpserver API differs between major versions,
+// Client routes through the one matching server version
+type serverAPI interface {
+	// listAssets fetches a page of assets permitted to user, and how many
+	// assets match filter in total
+	listAssets(ctx context.Context, c *Client, filter assetFilter, offset, limit int) ([]Asset, int, error)
+	listSystemUsers(ctx context.Context, c *Client, assetID string) ([]SystemUser, error)
+	// terminalURI is the koko websocket path of a terminal on asset
+	terminalURI(ctx context.Context, c *Client, assetID, systemUserID string) (string, error)
+	// fileManagerURIs are koko websocket path and elFinder connector path
+	// of a file manager session on asset
+	fileManagerURIs(c *Client, assetID string) (string, string, error)
+}
+
+// assetFilter narrows down assets, by exact hostname or by a keyword
+type assetFilter struct {
+	hostname string
+	search   string
+}
+
+// WithServerVersion skips version detection, e.g. "2.7.0" or "3"
+func WithServerVersion(version string) Option {
+	return func(c *Client) error {
+		api, err := apiForVersion(version)
+		if err != nil {
+			return err
+		}
+		c.version, c.api = version, api
+		return nil
+	}
+}
+
+// ServerVersion is Jumpserver version the client talks to, only major
+// version is known if server doesn't tell it
+func (c *Client) ServerVersion() string {
+	return c.version
+}
+
+func apiForVersion(version string) (serverAPI, error) {
+	major, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Jumpserver version %q", version)
+	}
+	switch {
+	case major < 2:
+		return nil, fmt.Errorf("unsupported Jumpserver version %s", version)
+	case major == 2:
+		return v2API{}, nil
+	default:
+		return v3API{}, nil
+	}
+}
+
+// detectVersion asks public settings of Jumpserver for its version. v2
+// wraps settings in "data" and v3 doesn't, which tells major version
+// apart when VERSION is absent
+func (c *Client) detectVersion(ctx context.Context) error {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	r, err := c.get(ctx, c.endpoint.String()+"/api/v1/settings/public/")
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	version := "2"
+	var settings map[string]json.RawMessage
+	if r.StatusCode == 200 && json.Unmarshal(content, &settings) == nil {
+		if data, ok := settings["data"]; ok {
+			settings = nil
+			json.Unmarshal(data, &settings)
+		} else {
+			version = "3"
+		}
+		var v string
+		if json.Unmarshal(settings["VERSION"], &v) == nil && v != "" {
+			version = strings.TrimPrefix(v, "v")
+		}
+	}
+
+	c.version = version
+	c.api, err = apiForVersion(version)
+	return err
+}
+
+// getJSON fetches path of Jumpserver API and decodes response into v
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := c.endpoint.String() + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return c.withReauth(func() error {
+		ctx, cancel := c.requestContext(ctx)
+		defer cancel()
+		r, err := c.get(ctx, u)
+		if err != nil {
+			return err
+		}
+		return decodeJSONResponse(r, v)
+	})
+}
+
+// postJSON posts body as json to path of Jumpserver API and decodes
+// response into v
+func (c *Client) postJSON(ctx context.Context, path string, body interface{}, v interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := c.endpoint.String() + path
+	return c.withReauth(func() error {
+		ctx, cancel := c.requestContext(ctx)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		// session authentication of django rest framework enforces csrf,
+		// token is read every time as logging in again rotates it
+		req.Header.Set("Referer", u)
+		if c.Jar != nil {
+			for _, cookie := range c.Jar.Cookies(req.URL) {
+				if cookie.Name == "csrftoken" || cookie.Name == "jms_csrftoken" {
+					req.Header.Set("X-CSRFToken", cookie.Value)
+				}
+			}
+		}
+
+		r, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		return decodeJSONResponse(r, v)
+	})
+}
+
+func decodeJSONResponse(r *http.Response, v interface{}) error {
+	defer r.Body.Close()
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if sessionExpired(r, content) {
+		return ErrSessionExpired
+	}
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return newAPIError(r, content)
+	}
+	return json.Unmarshal(content, v)
+}
+
+// v2API is Jumpserver v2, where assets are logged in as system users
+type v2API struct{}
+
+func (v2API) listAssets(ctx context.Context, c *Client, filter assetFilter, offset, limit int) ([]Asset, int, error) {
+	query := url.Values{}
+	if filter.hostname != "" {
+		query.Set("hostname", filter.hostname)
+	}
+	if filter.search != "" {
+		query.Set("search", filter.search)
+	}
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("display", "1")
+	query.Set("draw", "1")
+
+	var result struct {
+		Count   int     `json:"count"`
+		Results []Asset `json:"results"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/assets/assets/", query, &result); err != nil {
+		return nil, 0, err
+	}
+	return result.Results, result.Count, nil
+}
+
+func (v2API) listSystemUsers(ctx context.Context, c *Client, assetID string) ([]SystemUser, error) {
+	var result []SystemUser
+	err := c.getJSON(ctx, "/api/v1/perms/users/assets/"+url.PathEscape(assetID)+"/system-users/", nil, &result)
+	return result, err
+}
+
+func (v2API) terminalURI(ctx context.Context, c *Client, assetID, systemUserID string) (string, error) {
+	query := url.Values{}
+	query.Set("target_id", assetID)
+	query.Set("type", "asset")
+	query.Set("system_user_id", systemUserID)
+	return "/koko/ws/terminal/?" + query.Encode(), nil
+}
+
+func (v2API) fileManagerURIs(c *Client, assetID string) (string, string, error) {
+	return "/koko/ws/elfinder/?target_id=" + url.QueryEscape(assetID),
+		"/koko/elfinder/connector/" + url.PathEscape(assetID) + "/", nil
+}
+
+// v3API is Jumpserver v3, which replaced system users with accounts of
+// asset, and koko connects with a connection token instead of ids.
+// Accounts are exposed as SystemUser, ID of which is account alias
+type v3API struct{}
+
+// v3Asset is how v3 describes an asset
+type v3Asset struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Platform struct {
+		Name string `json:"name"`
+	} `json:"platform"`
+	Protocols []struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	} `json:"protocols"`
+	Comment  string   `json:"comment"`
+	IsActive bool     `json:"is_active"`
+	Nodes    []string `json:"nodes_display"`
+}
+
+func (a v3Asset) asset() Asset {
+	asset := Asset{
+		ID:       a.ID,
+		Hostname: a.Name,
+		IP:       a.Address,
+		Platform: a.Platform.Name,
+		Comment:  a.Comment,
+		IsActive: a.IsActive,
+		Nodes:    a.Nodes,
+	}
+	for _, p := range a.Protocols {
+		asset.Protocols = append(asset.Protocols, fmt.Sprintf("%s/%d", p.Name, p.Port))
+	}
+	return asset
+}
+
+func (v3API) listAssets(ctx context.Context, c *Client, filter assetFilter, offset, limit int) ([]Asset, int, error) {
+	query := url.Values{}
+	if filter.hostname != "" {
+		query.Set("name", filter.hostname)
+	}
+	if filter.search != "" {
+		query.Set("search", filter.search)
+	}
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var result struct {
+		Count   int       `json:"count"`
+		Results []v3Asset `json:"results"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/perms/users/self/assets/", query, &result); err != nil {
+		return nil, 0, err
+	}
+	assets := make([]Asset, 0, len(result.Results))
+	for _, a := range result.Results {
+		assets = append(assets, a.asset())
+	}
+	return assets, result.Count, nil
+}
+
+func (v3API) listSystemUsers(ctx context.Context, c *Client, assetID string) ([]SystemUser, error) {
+	var result struct {
+		Accounts []struct {
+			Alias    string `json:"alias"`
+			Name     string `json:"name"`
+			Username string `json:"username"`
+		} `json:"permed_accounts"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/perms/users/self/assets/"+url.PathEscape(assetID)+"/", nil, &result); err != nil {
+		return nil, err
+	}
+
+	users := []SystemUser{}
+	for _, a := range result.Accounts {
+		id := a.Alias
+		if id == "" {
+			id = a.Name
+		}
+		users = append(users, SystemUser{ID: id, Name: a.Name, Username: a.Username})
+	}
+	return users, nil
+}
+
+// connectionToken asks Jumpserver for a one-off token authorizing koko to
+// connect account on asset
+func (v3API) connectionToken(ctx context.Context, c *Client, assetID, account, method string) (string, error) {
+	var result struct {
+		ID string `json:"id"`
+	}
+	err := c.postJSON(ctx, "/api/v1/authentication/connection-token/", map[string]string{
+		"asset":          assetID,
+		"account":        account,
+		"protocol":       "ssh",
+		"connect_method": method,
+		"input_username": "",
+		"input_secret":   "",
+	}, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to create connection token: %w", err)
+	}
+	return result.ID, nil
+}
+
+func (api v3API) terminalURI(ctx context.Context, c *Client, assetID, systemUserID string) (string, error) {
+	token, err := api.connectionToken(ctx, c, assetID, systemUserID, "web_cli")
+	if err != nil {
+		return "", err
+	}
+	return "/koko/ws/token/?token=" + url.QueryEscape(token), nil
+}
+
+func (v3API) fileManagerURIs(c *Client, assetID string) (string, string, error) {
+	return "", "", fmt.Errorf("file manager is not supported on Jumpserver %s yet", c.version)
+}
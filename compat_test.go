@@ -0,0 +1,74 @@
+package jmsh
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestDetectVersion(t *testing.T) {
+	fs := newFakeJumpserver(t)
+
+	for _, version := range []int{2, 3} {
+		fs.version = version
+		c, err := NewClient(fs.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := strconv.Itoa(version); c.ServerVersion() != expected {
+			t.Fatalf("expected version %s, got %s", expected, c.ServerVersion())
+		}
+	}
+
+	c, err := NewClient(fs.URL, WithServerVersion("v2.7.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.api.(v2API); !ok || c.ServerVersion() != "v2.7.1" {
+		t.Fatalf("unexpected api %T of version %s", c.api, c.ServerVersion())
+	}
+	if _, err := NewClient(fs.URL, WithServerVersion("1.5")); err == nil {
+		t.Fatal("expected unsupported version")
+	}
+}
+
+func TestV3(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.version = 3
+	c := login(t, fs)
+
+	asset, ok, err := c.FindAssetByHostname("node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || asset.ID != "asset-2" || asset.IP != "172.16.222.102" || asset.Protocols[0] != "ssh/22" {
+		t.Fatalf("unexpected asset %+v", asset)
+	}
+	if _, ok, err := c.FindAssetByHostname("node3"); err != nil || ok {
+		t.Fatalf("expected node3 not found, got %v %v", ok, err)
+	}
+
+	users, err := c.ListSystemUsers(asset.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != "root" || users[0].Username != "root" {
+		t.Fatalf("unexpected accounts %+v", users)
+	}
+
+	var out bytes.Buffer
+	status, err := c.ExecAsset(asset.ID, users[0].ID, "printf hi", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 0 || out.String() != "hi" {
+		t.Fatalf("unexpected status %d output %q", status, out.String())
+	}
+
+	if _, err := c.ExecAsset(asset.ID, "nobody", "uptime", &out); err == nil {
+		t.Fatal("expected unknown account to fail")
+	}
+	if _, err := c.OpenFileManager(asset.ID); err == nil {
+		t.Fatal("expected file manager unsupported on v3")
+	}
+}
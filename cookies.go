@@ -0,0 +1,128 @@
+package jmsh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/living42/jmsh/internal/atomicfile"
+)
+
+// PersistentJar is a cookie jar backed by a file, so sessions survive
+// between runs
+type PersistentJar struct {
+	path string
+	jar  *cookiejar.Jar
+
+	mu      sync.Mutex
+	entries map[string]jarEntry
+}
+
+type jarEntry struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// NewPersistentJar creates a jar and loads cookies saved in p, a missing
+// file is treated as an empty jar
+func NewPersistentJar(p string) (*PersistentJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	pj := &PersistentJar{path: p, jar: jar, entries: map[string]jarEntry{}}
+
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pj, nil
+		}
+		return nil, err
+	}
+
+	var entries []jarEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Cookie == nil || expired(e.Cookie) {
+			continue
+		}
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		pj.SetCookies(u, []*http.Cookie{e.Cookie})
+	}
+	return pj, nil
+}
+
+// SetCookies implements http.CookieJar
+func (pj *PersistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+	pj.jar.SetCookies(u, cookies)
+
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String()
+	for _, c := range cookies {
+		key := origin + "|" + c.Domain + "|" + c.Path + "|" + c.Name
+		if c.MaxAge < 0 || expired(c) {
+			delete(pj.entries, key)
+			continue
+		}
+		saved := *c
+		if c.MaxAge > 0 {
+			// MaxAge is relative, pin it so it stays meaningful after reload
+			saved.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		pj.entries[key] = jarEntry{URL: origin, Cookie: &saved}
+	}
+}
+
+// Cookies implements http.CookieJar
+func (pj *PersistentJar) Cookies(u *url.URL) []*http.Cookie {
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+	return pj.jar.Cookies(u)
+}
+
+// Clear forgets all cookies, call Save to remove them from disk as well
+func (pj *PersistentJar) Clear() error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+	pj.jar = jar
+	pj.entries = map[string]jarEntry{}
+	return nil
+}
+
+// Save writes cookies to disk atomically, only readable by current user
+func (pj *PersistentJar) Save() error {
+	pj.mu.Lock()
+	entries := make([]jarEntry, 0, len(pj.entries))
+	for _, e := range pj.entries {
+		if !expired(e.Cookie) {
+			entries = append(entries, e)
+		}
+	}
+	pj.mu.Unlock()
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(pj.path, content, 0600)
+}
+
+func expired(c *http.Cookie) bool {
+	return !c.Expires.IsZero() && c.Expires.Before(time.Now())
+}
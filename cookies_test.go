@@ -0,0 +1,51 @@
+package jmsh
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestPersistentJar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jmsh_cookies_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "jmsh", "cookies.json")
+
+	jar, err := NewPersistentJar(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("http://jms.example.com/core/auth/login/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "sessionid", Value: "abc", Path: "/", MaxAge: 3600},
+		{Name: "stale", Value: "x", Path: "/", Expires: time.Now().Add(-time.Hour)},
+	})
+	if err := jar.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	jar, err = NewPersistentJar(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := jar.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "sessionid" || cookies[0].Value != "abc" {
+		t.Fatalf("unexpected cookies after reload: %v", cookies)
+	}
+}
@@ -0,0 +1,410 @@
+package jmsh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// FileManager accesses files on an asset through koko's elFinder connector
+//
+// Paths are slash separated and start with the system user's folder, e.g.
+// "/root/logs/app.log", which is relative to the SFTP root configured for
+// that system user
+type FileManager struct {
+	client    *Client
+	ws        *websocket.Conn
+	connector string
+	sid       string
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// FileInfo describes a remote file
+type FileInfo struct {
+	Name  string `json:"name"`
+	Hash  string `json:"hash"`
+	PHash string `json:"phash"`
+	Mime  string `json:"mime"`
+	Size  int64  `json:"size"`
+	TS    int64  `json:"ts"`
+}
+
+// IsDir indicate whether it's a directory
+func (fi FileInfo) IsDir() bool {
+	return fi.Mime == "directory"
+}
+
+// OpenFileManager opens a file manager session for asset
+func (c *Client) OpenFileManager(assetID string) (*FileManager, error) {
+	return c.OpenFileManagerContext(context.Background(), assetID)
+}
+
+// OpenFileManagerContext is OpenFileManager, ctx bounds opening the
+// session only, call Close to end it
+func (c *Client) OpenFileManagerContext(ctx context.Context, assetID string) (*FileManager, error) {
+	wsURI, connector, err := c.api.fileManagerURIs(c, assetID)
+	if err != nil {
+		return nil, err
+	}
+	var ws *websocket.Conn
+	err = c.withReauth(func() error {
+		ws, err = c.dialWebsocket(ctx, wsURI)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var firstMsg Message
+	stop := watchContext(ctx, ws)
+	err = ws.ReadJSON(&firstMsg)
+	if cerr := stop(); cerr != nil {
+		return nil, cerr
+	}
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	c.trace.message("<", &firstMsg)
+	if firstMsg.Type != CONNECT {
+		ws.Close()
+		return nil, fmt.Errorf("Expected got CONNECT message, but got %s", firstMsg.Type)
+	}
+
+	fm := &FileManager{
+		client:    c,
+		ws:        ws,
+		connector: c.endpoint.String() + connector,
+		sid:       firstMsg.Id,
+	}
+	// session on koko lives as long as this websocket
+	go fm.keepalive()
+	return fm, nil
+}
+
+func (fm *FileManager) keepalive() {
+	for {
+		var msg Message
+		if err := fm.ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		fm.client.trace.message("<", &msg)
+		switch msg.Type {
+		case PING:
+			fm.client.trace.message(">", &msg)
+			if err := fm.ws.WriteJSON(&msg); err != nil {
+				return
+			}
+		case CLOSE:
+			fm.mu.Lock()
+			fm.closed = true
+			fm.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Close ends the session
+func (fm *FileManager) Close() error {
+	return fm.ws.Close()
+}
+
+type elfinderResponse struct {
+	Error json.RawMessage `json:"error"`
+	Cwd   *FileInfo       `json:"cwd"`
+	Files []FileInfo      `json:"files"`
+	Added []FileInfo      `json:"added"`
+}
+
+func (fm *FileManager) call(ctx context.Context, method string, params url.Values, body io.Reader, contentType string) (*elfinderResponse, error) {
+	fm.mu.Lock()
+	closed := fm.closed
+	fm.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("file manager session closed by server")
+	}
+
+	params.Set("sid", fm.sid)
+	req, err := http.NewRequestWithContext(ctx, method, fm.connector+"?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	r, err := fm.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.StatusCode != 200 {
+		return nil, newAPIError(r, content)
+	}
+
+	var result elfinderResponse
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Error) > 0 && string(result.Error) != "null" {
+		return nil, fmt.Errorf("elfinder %s failed: %s", params.Get("cmd"), elfinderError(result.Error))
+	}
+	return &result, nil
+}
+
+// elfinderError formats error field, which is a string or a list of
+// message key and arguments
+func elfinderError(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var l []string
+	if err := json.Unmarshal(raw, &l); err == nil {
+		return strings.Join(l, " ")
+	}
+	return string(raw)
+}
+
+func (fm *FileManager) list(ctx context.Context, hash string) (*elfinderResponse, error) {
+	ctx, cancel := fm.client.requestContext(ctx)
+	defer cancel()
+	params := url.Values{}
+	params.Set("cmd", "open")
+	if hash == "" {
+		params.Set("init", "1")
+	}
+	params.Set("target", hash)
+	return fm.call(ctx, "GET", params, nil, "")
+}
+
+func cleanPath(p string) string {
+	var parts []string
+	for _, s := range strings.Split(p, "/") {
+		switch s {
+		case "", ".":
+		case "..":
+			if len(parts) > 0 {
+				parts = parts[:len(parts)-1]
+			}
+		default:
+			parts = append(parts, s)
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// Stat returns information about file at p
+func (fm *FileManager) Stat(p string) (FileInfo, error) {
+	return fm.StatContext(context.Background(), p)
+}
+
+// StatContext is Stat bound to ctx
+func (fm *FileManager) StatContext(ctx context.Context, p string) (FileInfo, error) {
+	p = cleanPath(p)
+
+	res, err := fm.list(ctx, "")
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if res.Cwd == nil {
+		return FileInfo{}, fmt.Errorf("elfinder returned no root")
+	}
+	cur := *res.Cwd
+	if p == "/" {
+		return cur, nil
+	}
+
+	names := strings.Split(p[1:], "/")
+	for i, name := range names {
+		var child *FileInfo
+		for j, f := range res.Files {
+			if f.PHash == cur.Hash && f.Name == name {
+				child = &res.Files[j]
+				break
+			}
+		}
+		if child == nil {
+			walked := "/" + strings.Join(names[:i+1], "/")
+			return FileInfo{}, &os.PathError{Op: "stat", Path: walked, Err: os.ErrNotExist}
+		}
+		if i == len(names)-1 {
+			return *child, nil
+		}
+		if !child.IsDir() {
+			walked := "/" + strings.Join(names[:i+1], "/")
+			return FileInfo{}, fmt.Errorf("%s is not a directory", walked)
+		}
+		if res, err = fm.list(ctx, child.Hash); err != nil {
+			return FileInfo{}, err
+		}
+		cur = *child
+	}
+	return cur, nil
+}
+
+// List returns entries of directory at p
+func (fm *FileManager) List(p string) ([]FileInfo, error) {
+	return fm.ListContext(context.Background(), p)
+}
+
+// ListContext is List bound to ctx
+func (fm *FileManager) ListContext(ctx context.Context, p string) ([]FileInfo, error) {
+	dir, err := fm.StatContext(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", p)
+	}
+	res, err := fm.list(ctx, dir.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []FileInfo
+	for _, f := range res.Files {
+		if f.PHash == dir.Hash {
+			entries = append(entries, f)
+		}
+	}
+	return entries, nil
+}
+
+// Mkdir creates directory name under dir, it's fine if it already exists
+func (fm *FileManager) Mkdir(dir, name string) error {
+	return fm.MkdirContext(context.Background(), dir, name)
+}
+
+// MkdirContext is Mkdir bound to ctx
+func (fm *FileManager) MkdirContext(ctx context.Context, dir, name string) error {
+	if _, err := fm.StatContext(ctx, dir+"/"+name); err == nil {
+		return nil
+	}
+	parent, err := fm.StatContext(ctx, dir)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("cmd", "mkdir")
+	params.Set("target", parent.Hash)
+	params.Set("name", name)
+	ctx, cancel := fm.client.requestContext(ctx)
+	defer cancel()
+	_, err = fm.call(ctx, "GET", params, nil, "")
+	return err
+}
+
+// Download copies content of file at p into w, starting from offset.
+// It returns number of bytes written
+func (fm *FileManager) Download(p string, offset int64, w io.Writer) (int64, error) {
+	return fm.DownloadContext(context.Background(), p, offset, w)
+}
+
+// DownloadContext is Download, cancelling ctx aborts the transfer
+func (fm *FileManager) DownloadContext(ctx context.Context, p string, offset int64, w io.Writer) (int64, error) {
+	f, err := fm.StatContext(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	if f.IsDir() {
+		return 0, fmt.Errorf("%s is a directory", p)
+	}
+
+	params := url.Values{}
+	params.Set("cmd", "file")
+	params.Set("target", f.Hash)
+	params.Set("download", "1")
+	params.Set("sid", fm.sid)
+	req, err := http.NewRequestWithContext(ctx, "GET", fm.connector+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	r, err := fm.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Body.Close()
+
+	switch r.StatusCode {
+	case 200:
+		if offset > 0 {
+			// server ignored Range, skip what we already have
+			if _, err := io.CopyN(ioutil.Discard, r.Body, offset); err != nil {
+				return 0, err
+			}
+		}
+	case 206:
+	default:
+		content, _ := ioutil.ReadAll(io.LimitReader(r.Body, 64<<10))
+		return 0, newAPIError(r, content)
+	}
+
+	return io.Copy(w, r.Body)
+}
+
+// Upload writes content of r into file name under directory dir
+func (fm *FileManager) Upload(dir, name string, r io.Reader) error {
+	return fm.UploadContext(context.Background(), dir, name, r)
+}
+
+// UploadContext is Upload, cancelling ctx aborts the transfer
+func (fm *FileManager) UploadContext(ctx context.Context, dir, name string, r io.Reader) error {
+	d, err := fm.StatContext(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if !d.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			if err := mw.WriteField("cmd", "upload"); err != nil {
+				return err
+			}
+			if err := mw.WriteField("target", d.Hash); err != nil {
+				return err
+			}
+			part, err := mw.CreateFormFile("upload[]", name)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, r); err != nil {
+				return err
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	params := url.Values{}
+	params.Set("cmd", "upload")
+	_, err = fm.call(ctx, "POST", params, pr, mw.FormDataContentType())
+	pr.Close()
+	return err
+}
@@ -0,0 +1,133 @@
+package jmsh
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func openFileManager(t *testing.T, fs *fakeJumpserver) *FileManager {
+	c := login(t, fs)
+	fm, err := c.OpenFileManager("asset-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fm.Close() })
+	return fm
+}
+
+func TestFileManagerStat(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.putFile("/root/logs/app.log", []byte("started\n"))
+	fm := openFileManager(t, fs)
+
+	info, err := fm.Stat("/root/logs/../logs/app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "app.log" || info.Size != 8 || info.IsDir() {
+		t.Fatalf("unexpected file info %+v", info)
+	}
+	if info, err := fm.Stat("/root/logs"); err != nil || !info.IsDir() {
+		t.Fatalf("expected a directory, got %+v, %v", info, err)
+	}
+
+	if _, err := fm.Stat("/root/missing/app.log"); !os.IsNotExist(err) || !strings.Contains(err.Error(), "/root/missing") {
+		t.Fatalf("expected not exist error naming missing directory, got %v", err)
+	}
+	if _, err := fm.Stat("/root/logs/app.log/x"); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected not a directory, got %v", err)
+	}
+}
+
+func TestFileManagerList(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.putFile("/root/b.txt", []byte("b"))
+	fs.putFile("/root/a.txt", []byte("a"))
+	fs.putFile("/root/dir/c.txt", []byte("c"))
+	fm := openFileManager(t, fs)
+
+	entries, err := fm.List("/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, " ") != "a.txt b.txt dir" {
+		t.Fatalf("unexpected entries %v", names)
+	}
+
+	if _, err := fm.List("/root/a.txt"); err == nil {
+		t.Fatal("expected listing a file to fail")
+	}
+}
+
+func TestFileManagerMkdir(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fm := openFileManager(t, fs)
+
+	if err := fm.Mkdir("/root", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fm.Stat("/root/new"); err != nil || !info.IsDir() {
+		t.Fatalf("expected a directory, got %+v, %v", info, err)
+	}
+	// existing directory is fine
+	if err := fm.Mkdir("/root", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Mkdir("/root/missing", "new"); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+}
+
+func TestFileManagerUpload(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fm := openFileManager(t, fs)
+
+	if err := fm.Upload("/root", "hello.txt", strings.NewReader("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if content, ok := fs.readFile("/root/hello.txt"); !ok || string(content) != "hello world" {
+		t.Fatalf("unexpected uploaded content %q", content)
+	}
+
+	fs.putFile("/root/file", nil)
+	if err := fm.Upload("/root/file", "hello.txt", strings.NewReader("")); err == nil {
+		t.Fatal("expected uploading into a file to fail")
+	}
+}
+
+func TestFileManagerDownload(t *testing.T) {
+	for _, ignoreRange := range []bool{false, true} {
+		fs := newFakeJumpserver(t)
+		fs.ignoreRange = ignoreRange
+		fs.putFile("/root/data", []byte("0123456789"))
+		fm := openFileManager(t, fs)
+
+		var out bytes.Buffer
+		n, err := fm.Download("/root/data", 0, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 10 || out.String() != "0123456789" {
+			t.Fatalf("unexpected download %d %q", n, out.String())
+		}
+
+		out.Reset()
+		n, err = fm.Download("/root/data", 4, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 6 || out.String() != "456789" {
+			t.Fatalf("unexpected download from offset with ignoreRange=%v: %d %q", ignoreRange, n, out.String())
+		}
+
+		if _, err := fm.Download("/root", 0, &out); err == nil {
+			t.Fatal("expected downloading a directory to fail")
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package jmsh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrNoExitStatus indicate connection closed before command finished
+var ErrNoExitStatus = fmt.Errorf("connection closed without exit status")
+
+// ExecAsset runs command on asset through a terminal session, copies its
+// output to stdout and returns its exit status
+//
+// Koko only offers interactive terminals, so the command is wrapped by
+// markers which are stripped from the output, leaving login banners and
+// command echo out of stdout
+func (c *Client) ExecAsset(targetID, systemUserID, command string, stdout io.Writer) (int, error) {
+	return c.ExecAssetContext(context.Background(), targetID, systemUserID, command, stdout)
+}
+
+// ExecAssetContext is ExecAsset, cancelling ctx closes the terminal, which
+// hangs up the command
+func (c *Client) ExecAssetContext(ctx context.Context, targetID, systemUserID, command string, stdout io.Writer) (int, error) {
+	// wide terminal avoid line wrapping inside markers
+	s, err := c.OpenSessionContext(ctx, targetID, systemUserID, WindowSize{Cols: 1000, Rows: 24})
+	if err != nil {
+		return -1, err
+	}
+	defer s.Close()
+
+	stop := watchContext(ctx, s)
+	status, err := execSession(s, command, stdout)
+	if cerr := stop(); cerr != nil {
+		return -1, cerr
+	}
+	return status, err
+}
+
+// execSession runs command in s
+func execSession(s *Session, command string, stdout io.Writer) (int, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return -1, err
+	}
+	ex := newExecFilter(hex.EncodeToString(nonce), stdout)
+
+	if _, err := io.WriteString(s, ex.script(command)); err != nil {
+		return -1, err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.Read(buf)
+		if n > 0 {
+			done, err := ex.feed(buf[:n])
+			if err != nil {
+				return -1, err
+			}
+			if done {
+				return ex.status, nil
+			}
+		}
+		if err == io.EOF {
+			return -1, ErrNoExitStatus
+		}
+		if err != nil {
+			return -1, err
+		}
+	}
+}
+
+// execFilter extracts command output between begin and end markers
+type execFilter struct {
+	nonce   string
+	out     io.Writer
+	buf     []byte
+	started bool
+	held    *string
+	status  int
+}
+
+const (
+	execBeginMarker = "JMSH_BEGIN_"
+	execEndMarker   = "JMSH_END_"
+)
+
+func newExecFilter(nonce string, out io.Writer) *execFilter {
+	return &execFilter{nonce: nonce, out: out}
+}
+
+// script builds the input typed into remote shell. Markers are printed by
+// joining two halves, so the echoed input never matches them. Command reads
+// stdin from /dev/null, otherwise it would swallow the rest of the input
+func (ex *execFilter) script(command string) string {
+	return fmt.Sprintf(
+		"stty -echo 2>/dev/null; printf '%%s%%s\\n' '%s' '%s'; { %s\n} </dev/null; printf '\\n%%s%%s:%%d\\n' '%s' '%s' $?; exit\n",
+		execBeginMarker, ex.nonce, command, execEndMarker, ex.nonce,
+	)
+}
+
+// feed consumes terminal output, it returns true once exit status is seen
+func (ex *execFilter) feed(data []byte) (bool, error) {
+	begin := execBeginMarker + ex.nonce
+	end := execEndMarker + ex.nonce + ":"
+
+	ex.buf = append(ex.buf, data...)
+	for {
+		idx := bytes.IndexByte(ex.buf, '\n')
+		if idx < 0 {
+			return false, nil
+		}
+		line := string(bytes.TrimSuffix(ex.buf[:idx], []byte("\r")))
+		ex.buf = ex.buf[idx+1:]
+
+		if !ex.started {
+			ex.started = strings.HasSuffix(line, begin)
+			continue
+		}
+
+		if strings.HasPrefix(line, end) {
+			status, err := strconv.Atoi(strings.TrimSpace(line[len(end):]))
+			if err != nil {
+				return false, fmt.Errorf("invalid exit status: %q", line)
+			}
+			ex.status = status
+			// held line was terminated by the newline printed before end
+			// marker, not by the command itself
+			if ex.held != nil && *ex.held != "" {
+				if _, err := io.WriteString(ex.out, *ex.held); err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		}
+
+		if ex.held != nil {
+			if _, err := io.WriteString(ex.out, *ex.held+"\n"); err != nil {
+				return false, err
+			}
+		}
+		ex.held = &line
+	}
+}
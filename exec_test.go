@@ -0,0 +1,49 @@
+package jmsh
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExecFilter(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		want   string
+		status int
+	}{
+		{"newline", "hi\r\n", "hi\n", 0},
+		{"no newline", "hi", "hi", 0},
+		{"empty", "", "", 0},
+		{"multi lines", "a\r\n\r\nb\r\n", "a\n\nb\n", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ex := newExecFilter("0123", &out)
+
+			// banner, echoed input, then what the script prints
+			stream := "Welcome\r\n$ " + ex.script("true") + "\r\n" +
+				"JMSH_BEGIN_0123\r\n" + tc.output + "\r\nJMSH_END_0123:3\r\n"
+
+			// feed byte by byte to exercise buffering
+			var done bool
+			for i := 0; i < len(stream) && !done; i++ {
+				var err error
+				if done, err = ex.feed([]byte{stream[i]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !done {
+				t.Fatal("exit status not found")
+			}
+			if ex.status != 3 {
+				t.Fatalf("expected status 3, got %d", ex.status)
+			}
+			if out.String() != tc.want {
+				t.Fatalf("expected output %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,842 @@
+package jmsh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	fakeKeyOnce sync.Once
+	fakeKey     *rsa.PrivateKey
+)
+
+// fakeJumpserver mimics the parts of Jumpserver v2.7 jmsh talks to, or
+// v3 if version is set to 3
+type fakeJumpserver struct {
+	*httptest.Server
+
+	version int
+
+	username string
+	password string
+	otp      string
+	captcha  string
+	// hybrid makes login page expect password encrypted with AES and the
+	// key with RSA, like newer Jumpserver
+	hybrid bool
+	// captchaKey is captcha_0 of current captcha, refreshing changes it
+	captchaKey string
+	// loginError is shown instead of accepting any login, e.g. to mimic a
+	// locked account
+	loginError string
+	// unauthenticated is how requests without valid session are answered,
+	// 401 by default, "403" like django rest framework without a way to
+	// challenge, "403-detail" likewise but without code in body as its
+	// default exception handler does, or "redirect" to login page like
+	// django views
+	unauthenticated string
+
+	privateToken    string
+	accessKeyID     string
+	accessKeySecret string
+
+	assets      []Asset
+	systemUsers map[string][]SystemUser
+
+	mu       sync.Mutex
+	csrf     string
+	sessions map[string]bool
+	// tokens are v3 connection tokens not used yet, mapped to asset id
+	tokens  map[string]string
+	pending map[string]bool
+	nextID  int
+
+	// files are what file manager sees, keyed by clean path, the top level
+	// directories are system users
+	files map[string]*fakeFile
+	// fmSessions are sids of open file manager websockets
+	fmSessions map[string]bool
+	// ignoreRange makes file download always send the whole file, like
+	// older koko
+	ignoreRange bool
+}
+
+type fakeFile struct {
+	dir     bool
+	content []byte
+	ts      int64
+}
+
+func newFakeJumpserver(t *testing.T) *fakeJumpserver {
+	fakeKeyOnce.Do(func() {
+		var err error
+		if fakeKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			panic(err)
+		}
+	})
+
+	fs := &fakeJumpserver{
+		username:    "admin",
+		password:    "zeqing",
+		systemUsers: map[string][]SystemUser{},
+		sessions:    map[string]bool{},
+		pending:     map[string]bool{},
+		tokens:      map[string]string{},
+		files:       map[string]*fakeFile{"/": {dir: true}, "/root": {dir: true}},
+		fmSessions:  map[string]bool{},
+		captchaKey:  "captchakey",
+		version:     2,
+	}
+	for i := 1; i <= 2; i++ {
+		id := fmt.Sprintf("asset-%d", i)
+		fs.assets = append(fs.assets, Asset{
+			ID:        id,
+			Hostname:  fmt.Sprintf("node%d", i),
+			IP:        fmt.Sprintf("172.16.222.%d", 100+i),
+			Platform:  "Linux",
+			Protocols: []string{"ssh/22"},
+			IsActive:  true,
+			Nodes:     []string{"/Default/test"},
+		})
+		fs.systemUsers[id] = []SystemUser{{ID: "su-root", Name: "root", Username: "root"}}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", fs.handleIndex)
+	mux.HandleFunc("/core/auth/login/", fs.handleLogin)
+	mux.HandleFunc("/core/auth/login/otp/", fs.handleOTP)
+	mux.HandleFunc("/core/auth/logout/", fs.handleLogout)
+	mux.HandleFunc("/core/auth/captcha/image/", fs.handleCaptcha)
+	mux.HandleFunc("/core/auth/captcha/refresh/", fs.handleCaptchaRefresh)
+	mux.HandleFunc("/api/v1/users/profile/", fs.authenticated(fs.handleProfile))
+	mux.HandleFunc("/api/v1/assets/assets/", fs.authenticated(fs.handleAssets))
+	mux.HandleFunc("/api/v1/perms/users/assets/", fs.authenticated(fs.handleSystemUsers))
+	mux.HandleFunc("/koko/ws/terminal/", fs.authenticated(fs.handleTerminal))
+	mux.HandleFunc("/koko/ws/elfinder/", fs.authenticated(fs.handleFileManager))
+	mux.HandleFunc("/koko/elfinder/connector/", fs.authenticated(fs.handleConnector))
+	mux.HandleFunc("/api/v1/settings/public/", fs.handlePublicSettings)
+	mux.HandleFunc("/api/v1/perms/users/self/assets/", fs.authenticated(fs.handleV3Assets))
+	mux.HandleFunc("/api/v1/authentication/connection-token/", fs.authenticated(fs.handleConnectionToken))
+	mux.HandleFunc("/koko/ws/token/", fs.authenticated(fs.handleTokenTerminal))
+	fs.Server = httptest.NewServer(mux)
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+// addAssets adds n more assets named host<i>
+func (fs *fakeJumpserver) addAssets(n int) {
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("bulk-%d", i)
+		fs.assets = append(fs.assets, Asset{
+			ID:       id,
+			Hostname: fmt.Sprintf("host%03d", i),
+			IP:       fmt.Sprintf("10.0.%d.%d", i/256, i%256),
+			IsActive: true,
+			Nodes:    []string{"/Default/bulk"},
+		})
+	}
+}
+
+// expireSessions logs out every client logged in with password
+func (fs *fakeJumpserver) expireSessions() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.sessions = map[string]bool{}
+}
+
+func (fs *fakeJumpserver) newToken() string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.nextID++
+	return fmt.Sprintf("token%d", fs.nextID)
+}
+
+func (fs *fakeJumpserver) cookie(r *http.Request, name string) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func (fs *fakeJumpserver) loggedIn(r *http.Request) bool {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return fs.checkAuthorization(r, auth)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.sessions[fs.cookie(r, "sessionid")]
+}
+
+var signatureHeader = regexp.MustCompile(`^Signature keyId="(.+?)",algorithm="hmac-sha256",headers="\(request-target\) accept date",signature="(.+?)"$`)
+
+func (fs *fakeJumpserver) checkAuthorization(r *http.Request, auth string) bool {
+	if fs.privateToken != "" && auth == "Token "+fs.privateToken {
+		return true
+	}
+	m := signatureHeader.FindStringSubmatch(auth)
+	if fs.accessKeyID == "" || m == nil || m[1] != fs.accessKeyID {
+		return false
+	}
+	signing := fmt.Sprintf("(request-target): %s %s\naccept: %s\ndate: %s",
+		strings.ToLower(r.Method), r.URL.RequestURI(), r.Header.Get("Accept"), r.Header.Get("Date"))
+	mac := hmac.New(sha256.New, []byte(fs.accessKeySecret))
+	mac.Write([]byte(signing))
+	return m[2] == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (fs *fakeJumpserver) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !fs.loggedIn(r) {
+			switch fs.unauthenticated {
+			case "403":
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"detail":"身份认证信息未提供。","code":"not_authenticated"}`)
+			case "403-detail":
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"detail":"Authentication credentials were not provided."}`)
+			case "redirect":
+				http.Redirect(w, r, "/core/auth/login/?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"detail":"Authentication credentials were not provided."}`)
+			}
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (fs *fakeJumpserver) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !fs.loggedIn(r) {
+		http.Redirect(w, r, "/core/auth/login/", http.StatusFound)
+		return
+	}
+	fmt.Fprint(w, "<html>index</html>")
+}
+
+func (fs *fakeJumpserver) handleLogout(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	delete(fs.sessions, fs.cookie(r, "sessionid"))
+	fs.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/core/auth/login/", http.StatusFound)
+}
+
+func (fs *fakeJumpserver) renderForm(w http.ResponseWriter, login bool, errMsg string) {
+	csrf := fs.newToken()
+	fs.mu.Lock()
+	fs.csrf = csrf
+	fs.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: csrf, Path: "/"})
+
+	der, _ := x509.MarshalPKIXPublicKey(&fakeKey.PublicKey)
+	pemText := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if login && fs.hybrid {
+		http.SetCookie(w, &http.Cookie{Name: "jms_public_key", Value: base64.StdEncoding.EncodeToString(pemText), Path: "/"})
+	}
+
+	fmt.Fprint(w, "<!DOCTYPE html>\n<html><body>\n<form class=\"m-t\" role=\"form\" method=\"post\" action=\"\">\n")
+	fmt.Fprintf(w, `<input type='hidden' value='%s' name='csrfmiddlewaretoken' />`+"\n", csrf)
+	if errMsg != "" {
+		fmt.Fprintf(w, "<div style=\"line-height: 17px;\">\n  <p class=\"red-fonts\">%s</p>\n</div>\n", html.EscapeString(errMsg))
+	}
+	if login {
+		fmt.Fprint(w, `<input type="text" class="form-control" name="username" placeholder="Username" required>
+<input type="password" class="form-control" id="password" placeholder="Password" required>
+<input id="password-hidden" type="text" style="display:none" name="password">
+`)
+		if fs.captcha != "" {
+			fs.mu.Lock()
+			key := fs.captchaKey
+			fs.mu.Unlock()
+			fmt.Fprintf(w, `<img src="/core/auth/captcha/image/%s/" alt="captcha" class="captcha" />
+<input id="id_captcha_0" name="captcha_0" type="hidden" value="%s" />
+<input autocomplete="off" id="id_captcha_1" name="captcha_1" type="text" />
+`, key, key)
+		}
+		fmt.Fprint(w, "<button type=\"submit\" class=\"btn btn-primary\">Login</button>\n")
+	} else {
+		fmt.Fprint(w, `<input type="text" class="form-control input-style" name="otp_code" placeholder="" required autofocus>
+<button type="submit" class="btn btn-primary block full-width m-b">Next</button>
+`)
+	}
+	fmt.Fprint(w, "</form>\n")
+	if login && fs.hybrid {
+		fmt.Fprint(w, `<script>
+  var rsaPublicKeyText = getCookie("jms_public_key").replaceAll('"', '')
+  var rsaPublicKey = atob(rsaPublicKeyText)
+  function encryptLoginPassword(password, rsaPublicKey) {
+    var aesKey = (Math.random() + 1).toString(36).substring(2)
+    const keyCipher = rsaEncrypt(aesKey, rsaPublicKey)
+    const passwordCipher = aesEncrypt(password, aesKey)
+    return keyCipher + ":" + passwordCipher
+  }
+</script>
+`)
+	} else if login {
+		js, _ := json.Marshal(string(pemText))
+		fmt.Fprintf(w, "<script>\n  var rsaPublicKey = %s\n  function encryptLoginPassword(){}\n</script>\n", js)
+	}
+	fmt.Fprint(w, "</body></html>\n")
+}
+
+// decryptPassword undoes what login page does to password
+func (fs *fakeJumpserver) decryptPassword(text string) (string, error) {
+	rsaDecrypt := func(text string) ([]byte, error) {
+		encrypted, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, err
+		}
+		return rsa.DecryptPKCS1v15(rand.Reader, fakeKey, encrypted)
+	}
+	if !fs.hybrid {
+		password, err := rsaDecrypt(text)
+		return string(password), err
+	}
+
+	parts := strings.SplitN(text, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("not hybrid encrypted")
+	}
+	key, err := rsaDecrypt(parts[0])
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(encrypted)%block.BlockSize() != 0 {
+		return "", fmt.Errorf("invalid aes cipher text")
+	}
+	plain := make([]byte, len(encrypted))
+	for i := 0; i < len(encrypted); i += block.BlockSize() {
+		block.Decrypt(plain[i:], encrypted[i:])
+	}
+	return string(bytes.TrimRight(plain, "\x00")), nil
+}
+
+func (fs *fakeJumpserver) checkCSRF(r *http.Request) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return r.PostFormValue("csrfmiddlewaretoken") == fs.csrf
+}
+
+func (fs *fakeJumpserver) login(w http.ResponseWriter) {
+	sid := fs.newToken()
+	fs.mu.Lock()
+	fs.sessions[sid] = true
+	fs.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: sid, Path: "/", MaxAge: 3600})
+}
+
+func (fs *fakeJumpserver) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/core/auth/login/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == "GET" {
+		fs.renderForm(w, true, "")
+		return
+	}
+	if !fs.checkCSRF(r) {
+		http.Error(w, "CSRF verification failed", http.StatusForbidden)
+		return
+	}
+	fs.mu.Lock()
+	captchaKey := fs.captchaKey
+	fs.mu.Unlock()
+	if fs.captcha != "" && (r.PostFormValue("captcha_0") != captchaKey || r.PostFormValue("captcha_1") != fs.captcha) {
+		fs.renderForm(w, true, "Captcha invalid")
+		return
+	}
+	if fs.loginError != "" {
+		fs.renderForm(w, true, fs.loginError)
+		return
+	}
+
+	ok := r.PostFormValue("username") == fs.username
+	password, err := fs.decryptPassword(r.PostFormValue("password"))
+	if err != nil || password != fs.password {
+		ok = false
+	}
+	if !ok {
+		fs.renderForm(w, true, "The username or password you entered is incorrect, please enter it again. You can also try 4 times (The account will be temporarily locked for 30 minutes)")
+		return
+	}
+
+	if fs.otp != "" {
+		pid := fs.newToken()
+		fs.mu.Lock()
+		fs.pending[pid] = true
+		fs.mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: "pending", Value: pid, Path: "/"})
+		http.Redirect(w, r, "/core/auth/login/otp/", http.StatusFound)
+		return
+	}
+	fs.login(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (fs *fakeJumpserver) handleOTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	pending := fs.pending[fs.cookie(r, "pending")]
+	fs.mu.Unlock()
+	if !pending {
+		http.Redirect(w, r, "/core/auth/login/", http.StatusFound)
+		return
+	}
+	if r.Method == "GET" {
+		fs.renderForm(w, false, "")
+		return
+	}
+	if !fs.checkCSRF(r) {
+		http.Error(w, "CSRF verification failed", http.StatusForbidden)
+		return
+	}
+	if r.PostFormValue("otp_code") != fs.otp {
+		fs.renderForm(w, false, "MFA code invalid, or ntp sync server time")
+		return
+	}
+	fs.login(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (fs *fakeJumpserver) handleCaptcha(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Write([]byte("\x89PNG\r\n\x1a\nfake"))
+}
+
+func (fs *fakeJumpserver) handleCaptchaRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Requested-With") != "XMLHttpRequest" {
+		http.NotFound(w, r)
+		return
+	}
+	key := fs.newToken()
+	fs.mu.Lock()
+	fs.captchaKey = key
+	fs.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]string{
+		"key":       key,
+		"image_url": "/core/auth/captcha/image/" + key + "/",
+		"audio_url": "/core/auth/captcha/audio/" + key + ".wav",
+	})
+}
+
+func (fs *fakeJumpserver) handleProfile(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{"username": fs.username})
+}
+
+func (fs *fakeJumpserver) handleAssets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var matched []Asset
+	for _, a := range fs.assets {
+		if h := q.Get("hostname"); h != "" && a.Hostname != h {
+			continue
+		}
+		if s := q.Get("search"); s != "" &&
+			!strings.Contains(a.Hostname, s) && !strings.Contains(a.IP, s) && !strings.Contains(a.Comment, s) {
+			continue
+		}
+		matched = append(matched, a)
+	}
+
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	page := []Asset{}
+	if offset < len(matched) {
+		end := offset + limit
+		if limit == 0 || end > len(matched) {
+			end = len(matched)
+		}
+		page = matched[offset:end]
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":   len(matched),
+		"results": page,
+	})
+}
+
+func (fs *fakeJumpserver) handleSystemUsers(w http.ResponseWriter, r *http.Request) {
+	m := regexp.MustCompile(`^/api/v1/perms/users/assets/([^/]+)/system-users/$`).FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	users, ok := fs.systemUsers[m[1]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"detail":"Not found."}`)
+		return
+	}
+	json.NewEncoder(w).Encode(users)
+}
+
+var execScript = regexp.MustCompile(
+	`printf '%s%s\\n' 'JMSH_BEGIN_' '(\w+)'; \{ (.*)\n\} </dev/null; printf '\\n%s%s:%d\\n' 'JMSH_END_' '(\w+)' \$\?; exit\n`)
+
+// fakeCommands are what the fake shell could run, with output and status
+var fakeCommands = map[string]struct {
+	output string
+	status int
+}{
+	"uptime":    {" 10:00:00 up 1 day\n", 0},
+	"printf hi": {"hi", 0},
+	"false":     {"", 1},
+}
+
+// handleTerminal is a koko terminal backed by a tiny shell, which echoes
+// input like a pty, understands exec scripts and exits on "exit"
+func (fs *fakeJumpserver) handleTerminal(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	cid := fs.newToken()
+	if err := ws.WriteJSON(&Message{Id: cid, Type: CONNECT}); err != nil {
+		return
+	}
+
+	var init Message
+	if err := ws.ReadJSON(&init); err != nil || init.Type != TERMINALINIT {
+		return
+	}
+	var size WindowSize
+	if err := json.Unmarshal([]byte(init.Data), &size); err != nil {
+		return
+	}
+
+	send := func(msgType, data string) error {
+		return ws.WriteJSON(&Message{Id: cid, Type: msgType, Data: data})
+	}
+	send(PING, "")
+	send(TERMINALDATA, "Welcome to node\r\n$ ")
+
+	for {
+		var msg Message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case TERMINALRESIZE:
+			json.Unmarshal([]byte(msg.Data), &size)
+			send(TERMINALDATA, fmt.Sprintf("resized %dx%d\r\n$ ", size.Cols, size.Rows))
+		case TERMINALDATA:
+			send(TERMINALDATA, strings.Replace(msg.Data, "\n", "\r\n", -1))
+
+			if m := execScript.FindStringSubmatch(msg.Data); m != nil {
+				cmd := fakeCommands[m[2]]
+				out := "JMSH_BEGIN_" + m[1] + "\n" + cmd.output +
+					"\nJMSH_END_" + m[3] + ":" + strconv.Itoa(cmd.status) + "\n"
+				send(TERMINALDATA, strings.Replace(out, "\n", "\r\n", -1))
+				send(CLOSE, "")
+				return
+			}
+			if strings.TrimSpace(msg.Data) == "exit" {
+				send(TERMINALDATA, "logout")
+				send(CLOSE, "")
+				return
+			}
+		}
+	}
+}
+
+func (fs *fakeJumpserver) handlePublicSettings(w http.ResponseWriter, r *http.Request) {
+	settings := map[string]interface{}{"XPACK_ENABLED": false}
+	if fs.version >= 3 {
+		json.NewEncoder(w).Encode(settings)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": settings})
+}
+
+// handleV3Assets serves both list and detail of assets permitted to user
+// on v3, where system users are replaced by accounts
+func (fs *fakeJumpserver) handleV3Assets(w http.ResponseWriter, r *http.Request) {
+	if fs.version < 3 {
+		http.NotFound(w, r)
+		return
+	}
+	type protocol struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	render := func(a Asset) map[string]interface{} {
+		var protocols []protocol
+		for _, p := range a.Protocols {
+			parts := strings.SplitN(p, "/", 2)
+			port, _ := strconv.Atoi(parts[1])
+			protocols = append(protocols, protocol{parts[0], port})
+		}
+		return map[string]interface{}{
+			"id":            a.ID,
+			"name":          a.Hostname,
+			"address":       a.IP,
+			"platform":      map[string]interface{}{"id": 1, "name": a.Platform},
+			"protocols":     protocols,
+			"comment":       a.Comment,
+			"is_active":     a.IsActive,
+			"nodes_display": a.Nodes,
+		}
+	}
+
+	if id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/perms/users/self/assets/"), "/"); id != "" {
+		for _, a := range fs.assets {
+			if a.ID != id {
+				continue
+			}
+			var accounts []map[string]string
+			for _, u := range fs.systemUsers[id] {
+				accounts = append(accounts, map[string]string{"alias": u.Name, "name": u.Name, "username": u.Username})
+			}
+			detail := render(a)
+			detail["permed_accounts"] = accounts
+			json.NewEncoder(w).Encode(detail)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"detail":"Not found."}`)
+		return
+	}
+
+	q := r.URL.Query()
+	results := []map[string]interface{}{}
+	for _, a := range fs.assets {
+		if name := q.Get("name"); name != "" && a.Hostname != name {
+			continue
+		}
+		if s := q.Get("search"); s != "" && !strings.Contains(a.Hostname, s) && !strings.Contains(a.IP, s) {
+			continue
+		}
+		results = append(results, render(a))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"count": len(results), "results": results})
+}
+
+func (fs *fakeJumpserver) handleConnectionToken(w http.ResponseWriter, r *http.Request) {
+	if fs.version < 3 || r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") == "" && r.Header.Get("X-CSRFToken") != fs.cookie(r, "csrftoken") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"detail":"CSRF Failed: CSRF token missing or incorrect."}`)
+		return
+	}
+	var req struct {
+		Asset   string `json:"asset"`
+		Account string `json:"account"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	found := false
+	for _, u := range fs.systemUsers[req.Asset] {
+		found = found || u.Name == req.Account
+	}
+	if !found {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"account":["Account not found"]}`)
+		return
+	}
+
+	token := fs.newToken()
+	fs.mu.Lock()
+	fs.tokens[token] = req.Asset
+	fs.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"id": token})
+}
+
+func (fs *fakeJumpserver) handleTokenTerminal(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	fs.mu.Lock()
+	_, ok := fs.tokens[token]
+	delete(fs.tokens, token)
+	fs.mu.Unlock()
+	if !ok {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+	fs.handleTerminal(w, r)
+}
+
+// putFile writes a remote file, creating its parent directories
+func (fs *fakeJumpserver) putFile(p string, content []byte) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for d := path.Dir(p); d != "/"; d = path.Dir(d) {
+		if fs.files[d] == nil {
+			fs.files[d] = &fakeFile{dir: true}
+		}
+	}
+	fs.nextID++
+	fs.files[p] = &fakeFile{content: content, ts: int64(fs.nextID)}
+}
+
+// readFile returns content of a remote file, ok is false if there's no
+// such file
+func (fs *fakeJumpserver) readFile(p string) (content []byte, ok bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f := fs.files[p]
+	if f == nil || f.dir {
+		return nil, false
+	}
+	return f.content, true
+}
+
+func elfinderHash(p string) string {
+	return "v1_" + base64.RawURLEncoding.EncodeToString([]byte(p))
+}
+
+// fileInfo describes file at p, fs.mu must be held
+func (fs *fakeJumpserver) fileInfo(p string) FileInfo {
+	f := fs.files[p]
+	info := FileInfo{Name: path.Base(p), Hash: elfinderHash(p), Size: int64(len(f.content)), TS: f.ts, Mime: "text/plain"}
+	if p == "/" {
+		info.Name = "/"
+	} else {
+		info.PHash = elfinderHash(path.Dir(p))
+	}
+	if f.dir {
+		info.Mime, info.Size = "directory", 0
+	}
+	return info
+}
+
+// lookup finds path of hash, fs.mu must be held
+func (fs *fakeJumpserver) lookup(hash string) (string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(hash, "v1_"))
+	if err != nil {
+		return "", false
+	}
+	_, ok := fs.files[string(raw)]
+	return string(raw), ok
+}
+
+// handleFileManager is koko's elfinder websocket, connector accepts sid
+// it tells as long as it's open
+func (fs *fakeJumpserver) handleFileManager(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	sid := fs.newToken()
+	fs.mu.Lock()
+	fs.fmSessions[sid] = true
+	fs.mu.Unlock()
+	defer func() {
+		fs.mu.Lock()
+		delete(fs.fmSessions, sid)
+		fs.mu.Unlock()
+	}()
+
+	if err := ws.WriteJSON(&Message{Id: sid, Type: CONNECT}); err != nil {
+		return
+	}
+	ws.WriteJSON(&Message{Id: sid, Type: PING})
+	for {
+		var msg Message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+	}
+}
+
+// handleConnector serves the elFinder commands file manager uses
+func (fs *fakeJumpserver) handleConnector(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.fmSessions[r.URL.Query().Get("sid")] {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid sid"}`)
+		return
+	}
+
+	reply := func(v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+	target, ok := fs.lookup(r.FormValue("target"))
+	if r.FormValue("cmd") == "open" && r.FormValue("init") == "1" {
+		target, ok = "/", true
+	}
+	if !ok {
+		reply(map[string]interface{}{"error": []string{"errFileNotFound"}})
+		return
+	}
+
+	switch r.FormValue("cmd") {
+	case "open":
+		files := []FileInfo{}
+		for p := range fs.files {
+			if p != "/" && path.Dir(p) == target {
+				files = append(files, fs.fileInfo(p))
+			}
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+		cwd := fs.fileInfo(target)
+		reply(map[string]interface{}{"cwd": &cwd, "files": files})
+	case "mkdir":
+		p := path.Join(target, r.FormValue("name"))
+		fs.files[p] = &fakeFile{dir: true}
+		reply(map[string]interface{}{"added": []FileInfo{fs.fileInfo(p)}})
+	case "upload":
+		f, header, err := r.FormFile("upload[]")
+		if err != nil {
+			reply(map[string]interface{}{"error": err.Error()})
+			return
+		}
+		content, _ := ioutil.ReadAll(f)
+		p := path.Join(target, header.Filename)
+		fs.nextID++
+		fs.files[p] = &fakeFile{content: content, ts: int64(fs.nextID)}
+		reply(map[string]interface{}{"added": []FileInfo{fs.fileInfo(p)}})
+	case "file":
+		content := fs.files[target].content
+		var offset int
+		if rng := r.Header.Get("Range"); rng != "" && !fs.ignoreRange {
+			offset, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		w.Write(content[offset:])
+	default:
+		reply(map[string]interface{}{"error": []string{"errUnknownCmd"}})
+	}
+}
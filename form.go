@@ -0,0 +1,250 @@
+package jmsh
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// PageError indicate a page doesn't look like what we expected, usually
+// because Jumpserver changed its templates
+type PageError struct {
+	Page    string
+	Missing string
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("%s: %s not found", e.Page, e.Missing)
+}
+
+// htmlForm is a form discovered in a page, with default values of its
+// fields as the browser would submit them
+type htmlForm struct {
+	action *url.URL
+	method string
+	fields url.Values
+}
+
+// has reports whether form contains field name
+func (f *htmlForm) has(name string) bool {
+	_, ok := f.fields[name]
+	return ok
+}
+
+// htmlPage is result of parsing a page
+type htmlPage struct {
+	forms   []*htmlForm
+	scripts []string
+	images  []map[string]string
+	// errors are texts of elements styled as error messages
+	errors []string
+}
+
+// errorClasses are classes Jumpserver and Django put on error messages
+var errorClasses = []string{"red-fonts", "errorlist", "errornote", "alert-danger"}
+
+// formWith returns the first form containing all the fields
+func (p *htmlPage) formWith(fields ...string) *htmlForm {
+	for _, f := range p.forms {
+		ok := true
+		for _, name := range fields {
+			ok = ok && f.has(name)
+		}
+		if ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// parsePage collects forms, inline scripts and images of page located at base
+func parsePage(base *url.URL, content []byte) (*htmlPage, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	page := &htmlPage{}
+	var cur *htmlForm
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attrs := map[string]string{}
+			for _, a := range n.Attr {
+				attrs[strings.ToLower(a.Key)] = a.Val
+			}
+
+			if hasClass(attrs["class"], errorClasses...) {
+				if text := textContent(n); text != "" {
+					page.errors = append(page.errors, text)
+				}
+				return
+			}
+
+			switch n.DataAtom {
+			case atom.Form:
+				action, err := base.Parse(attrs["action"])
+				if err != nil {
+					action = base
+				}
+				method := strings.ToUpper(attrs["method"])
+				if method == "" {
+					method = "GET"
+				}
+				form := &htmlForm{action: action, method: method, fields: url.Values{}}
+				page.forms = append(page.forms, form)
+
+				outer := cur
+				cur = form
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					walk(c)
+				}
+				cur = outer
+				return
+			case atom.Input:
+				if cur != nil && attrs["name"] != "" {
+					switch strings.ToLower(attrs["type"]) {
+					case "submit", "button", "image", "reset", "file":
+					case "checkbox", "radio":
+						if _, checked := attrs["checked"]; checked {
+							cur.fields.Add(attrs["name"], valueOr(attrs, "on"))
+						} else if !cur.has(attrs["name"]) {
+							cur.fields[attrs["name"]] = nil
+						}
+					default:
+						cur.fields.Add(attrs["name"], attrs["value"])
+					}
+				}
+			case atom.Textarea, atom.Select:
+				if cur != nil && attrs["name"] != "" && !cur.has(attrs["name"]) {
+					cur.fields[attrs["name"]] = nil
+				}
+			case atom.Script:
+				if attrs["src"] == "" && n.FirstChild != nil {
+					page.scripts = append(page.scripts, n.FirstChild.Data)
+				}
+			case atom.Img:
+				page.images = append(page.images, attrs)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return page, nil
+}
+
+// hasClass reports whether class attribute contains any of names
+func hasClass(class string, names ...string) bool {
+	for _, c := range strings.Fields(class) {
+		for _, name := range names {
+			if c == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// textContent is text inside n with whitespaces collapsed
+func textContent(n *html.Node) string {
+	var parts []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			parts = append(parts, strings.Fields(n.Data)...)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(parts, " ")
+}
+
+func valueOr(attrs map[string]string, def string) string {
+	if v, ok := attrs["value"]; ok {
+		return v
+	}
+	return def
+}
+
+// scriptContains reports whether any inline script contains text
+func (p *htmlPage) scriptContains(text string) bool {
+	for _, script := range p.scripts {
+		if strings.Contains(script, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsString finds string literal assigned to variable name in page scripts
+func (p *htmlPage) jsString(name string) (string, bool) {
+	for _, script := range p.scripts {
+		idx := strings.Index(script, name)
+		for idx >= 0 {
+			rest := strings.TrimLeft(script[idx+len(name):], " \t")
+			if strings.HasPrefix(rest, "=") {
+				if s, ok := readJSString(strings.TrimLeft(rest[1:], " \t\r\n")); ok {
+					return s, true
+				}
+			}
+			next := strings.Index(script[idx+len(name):], name)
+			if next < 0 {
+				break
+			}
+			idx += len(name) + next
+		}
+	}
+	return "", false
+}
+
+// readJSString decodes a single or double quoted JavaScript string literal
+// at beginning of s
+func readJSString(s string) (string, bool) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", false
+	}
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), true
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if i+4 < len(s) {
+					if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+						b.WriteRune(rune(r))
+						i += 4
+						continue
+					}
+				}
+				b.WriteByte('u')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
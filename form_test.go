@@ -0,0 +1,93 @@
+package jmsh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParsePage(t *testing.T) {
+	base, _ := url.Parse("https://js.example.com/core/auth/login/?next=/")
+	content := []byte(`<html><body>
+<form id="search" action="/search/"><input name="q"></form>
+<FORM METHOD=POST action="">
+<input value="tok" name=csrfmiddlewaretoken type=hidden>
+<input name="username" type="text">
+<input type="checkbox" name="remember" checked>
+<input type="submit" name="go" value="Login">
+<img class="captcha" src="/core/auth/captcha/image/abc/">
+</FORM>
+<script src="/static/js/jquery.js"></script>
+<script>
+  var other = "x";
+  var rsaPublicKey = '-----BEGIN PUBLIC KEY-----\nMIIB/x\n-----END PUBLIC KEY-----\n'
+</script>
+</body></html>`)
+
+	page, err := parsePage(base, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := page.formWith("csrfmiddlewaretoken", "username")
+	if form == nil {
+		t.Fatal("login form not found")
+	}
+	if form.method != http.MethodPost {
+		t.Fatalf("expected POST, got %s", form.method)
+	}
+	if form.action.String() != base.String() {
+		t.Fatalf("expected action %s, got %s", base, form.action)
+	}
+	if v := form.fields.Get("csrfmiddlewaretoken"); v != "tok" {
+		t.Fatalf("expected csrf token tok, got %q", v)
+	}
+	if v := form.fields.Get("remember"); v != "on" {
+		t.Fatalf("expected checked checkbox to be on, got %q", v)
+	}
+	if form.has("go") {
+		t.Fatal("submit button should not be a field")
+	}
+
+	if f := page.formWith("q"); f == nil || f.action.String() != "https://js.example.com/search/" || f.method != "GET" {
+		t.Fatalf("unexpected search form %+v", f)
+	}
+	if f := page.formWith("otp_code"); f != nil {
+		t.Fatalf("unexpected form %+v", f)
+	}
+
+	key, ok := page.jsString("rsaPublicKey")
+	if !ok {
+		t.Fatal("rsaPublicKey not found")
+	}
+	if expected := "-----BEGIN PUBLIC KEY-----\nMIIB/x\n-----END PUBLIC KEY-----\n"; key != expected {
+		t.Fatalf("expected %q, got %q", expected, key)
+	}
+	if _, ok := page.jsString("missing"); ok {
+		t.Fatal("unexpected variable found")
+	}
+
+	if len(page.images) != 1 || page.images[0]["src"] != "/core/auth/captcha/image/abc/" {
+		t.Fatalf("unexpected images %v", page.images)
+	}
+}
+
+func TestFetchLoginPageChanged(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<form method="post"><input name="username"><input name="password"></form>`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.FetchLoginPage()
+	if err == nil || err.Error() != "login page: csrfmiddlewaretoken not found" {
+		t.Fatalf("expected missing csrfmiddlewaretoken, got %v", err)
+	}
+	if _, ok := err.(*PageError); !ok {
+		t.Fatalf("expected PageError, got %T", err)
+	}
+}
@@ -6,4 +6,6 @@ require (
 	github.com/gorilla/websocket v1.4.2
 	github.com/manifoldco/promptui v0.8.0
 	github.com/mattn/go-tty v0.0.3
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	golang.org/x/net v0.0.0-20201224014010-6772e930b67b
 )
@@ -0,0 +1,45 @@
+// Package atomicfile writes files of jmsh, cookies, config and
+// credentials, without leaving them half written
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// WriteFile replaces file at p with content through a temporary
+// file, so readers never see it half written. Missing directories are
+// created with mode 0700
+func WriteFile(p string, content []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(path.Dir(p), 0700); err != nil {
+		return err
+	}
+
+	renamed := false
+	t, err := ioutil.TempFile(path.Dir(p), path.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		t.Close()
+		if !renamed {
+			os.Remove(t.Name())
+		}
+	}()
+
+	if err := t.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err := t.Write(content); err != nil {
+		return err
+	}
+	if err := t.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(t.Name(), p); err != nil {
+		return err
+	}
+	renamed = true
+	return nil
+}
@@ -1,33 +1,64 @@
 package jmsh
 
 import (
-	"crypto/rand"
+	"context"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
-	"regexp"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/mattn/go-tty"
 )
 
 // Client for interact with Jumpserver
 type Client struct {
 	endpoint *url.URL
+	auth     authenticator
+	version  string
+	api      serverAPI
+
+	reauth    func(*Client) error
+	reauthMu  sync.Mutex
+	reauthGen int
+
+	connectTimeout time.Duration
+	requestTimeout time.Duration
+	transport      *http.Transport
+	trace          *tracer
+
 	*http.Client
 }
 
+// Option customizes Client created by NewClient
+type Option func(*Client) error
+
+// WithCookieJar makes client use jar instead of an empty in-memory one,
+// e.g. a PersistentJar to reuse session across runs
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Client) error {
+		c.Jar = jar
+		return nil
+	}
+}
+
 // NewClient creates client
-func NewClient(endpoint string) (*Client, error) {
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	return NewClientContext(context.Background(), endpoint, opts...)
+}
+
+// NewClientContext creates client, ctx bounds detecting server version
+func NewClientContext(ctx context.Context, endpoint string, opts ...Option) (*Client, error) {
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
@@ -36,41 +67,137 @@ func NewClient(endpoint string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Client{endpoint: u, Client: &http.Client{Jar: jar}}, nil
+	c := &Client{
+		endpoint:       u,
+		connectTimeout: DefaultConnectTimeout,
+		requestTimeout: DefaultRequestTimeout,
+	}
+	c.transport = http.DefaultTransport.(*http.Transport).Clone()
+	c.transport.DialContext = c.dialContext
+	c.Client = &http.Client{Jar: jar, Transport: &traceTransport{c: c}}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	c.transport.TLSHandshakeTimeout = c.connectTimeout
+	if c.api == nil {
+		if err := c.detectVersion(ctx); err != nil {
+			return nil, fmt.Errorf("failed to detect Jumpserver version: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// IsLoggedIn probes whether cookies in jar still hold a valid session
+func (c *Client) IsLoggedIn() (bool, error) {
+	return c.IsLoggedInContext(context.Background())
+}
+
+// IsLoggedInContext is IsLoggedIn bound to ctx
+func (c *Client) IsLoggedInContext(ctx context.Context) (bool, error) {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	r, err := c.get(ctx, c.endpoint.String()+"/api/v1/users/profile/")
+	if err != nil {
+		return false, err
+	}
+	defer r.Body.Close()
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return false, err
+	}
+
+	// an expired session either gets 401/403 or redirected to login page
+	if sessionExpired(r, content) {
+		return false, nil
+	}
+	if r.StatusCode != 200 {
+		return false, newAPIError(r, content)
+	}
+	return true, nil
+}
+
+// Logout ends the session on Jumpserver, cookies in jar are no longer
+// valid afterwards
+func (c *Client) Logout() error {
+	return c.LogoutContext(context.Background())
+}
+
+// LogoutContext is Logout bound to ctx
+func (c *Client) LogoutContext(ctx context.Context) error {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	r, err := c.get(ctx, c.endpoint.String()+"/core/auth/logout/")
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	// django redirects to login page once logged out
+	if r.StatusCode != 200 {
+		return newAPIError(r, content)
+	}
+	return nil
 }
 
 // FetchLoginPage access and get csrftoken rsa public key
 func (c *Client) FetchLoginPage() (*LoginPage, error) {
-	r, err := c.Get(c.endpoint.String() + "/core/auth/login/")
+	return c.FetchLoginPageContext(context.Background())
+}
+
+// FetchLoginPageContext is FetchLoginPage bound to ctx
+func (c *Client) FetchLoginPageContext(ctx context.Context) (*LoginPage, error) {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	r, err := c.get(ctx, c.endpoint.String()+"/core/auth/login/")
 	if err != nil {
 		return nil, err
 	}
 	defer r.Body.Close()
 
 	content, err := ioutil.ReadAll(r.Body)
-	text := string(content)
+	if err != nil {
+		return nil, err
+	}
 
 	if r.StatusCode != 200 {
-		return nil, fmt.Errorf("access login page got %s", r.Status)
+		return nil, newAPIError(r, content)
 	}
 
-	m := regexp.MustCompile(`name="csrfmiddlewaretoken"\s*?value="(.+?)"`).FindStringSubmatch(text)
-	if len(m) == 0 {
-		return nil, fmt.Errorf("failed to get csrftoken")
+	page, err := parsePage(r.Request.URL, content)
+	if err != nil {
+		return nil, err
 	}
-	csrftoken := m[1]
 
-	m = regexp.MustCompile(`var rsaPublicKey = (".+")`).FindStringSubmatch(text)
-	if len(m) == 0 {
-		return nil, fmt.Errorf("failed to get rsaPublicKey")
+	form := page.formWith("username", "password")
+	if form == nil {
+		return nil, &PageError{Page: "login page", Missing: "form with username and password"}
+	}
+	if !form.has("csrfmiddlewaretoken") {
+		return nil, &PageError{Page: "login page", Missing: "csrfmiddlewaretoken"}
 	}
 
-	var pubKeyText string
-	if err := json.Unmarshal([]byte(m[1]), &pubKeyText); err != nil {
-		return nil, fmt.Errorf("failed to parse rsaPublicKey in json form: %s", err)
+	// newer pages hand the key out in a cookie instead of inline script
+	pubKeyText, ok := page.jsString("rsaPublicKey")
+	if !ok {
+		pubKeyText, ok = c.publicKeyCookie(r.Request.URL)
+	}
+	if !ok {
+		return nil, &PageError{Page: "login page", Missing: "rsaPublicKey"}
+	}
+	scheme := schemeRSA
+	if page.scriptContains("aesEncrypt(") {
+		scheme = schemeHybrid
 	}
 
 	block, _ := pem.Decode([]byte(pubKeyText))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse rsaPublicKey in pem form")
+	}
 	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse rsaPublicKey in pem form: %s", err)
@@ -80,73 +207,170 @@ func (c *Client) FetchLoginPage() (*LoginPage, error) {
 		return nil, fmt.Errorf("invalid rsaPublicKey on login page")
 	}
 
-	var captcha0 string
 	var captchaImg string
-	m = regexp.MustCompile(`name="captcha_0"\s*?value="(.+?)"`).FindStringSubmatch(text)
-	if len(m) > 0 {
-		captcha0 = m[1]
+	if captcha0 := form.fields.Get("captcha_0"); captcha0 != "" {
 		captchaImg = c.endpoint.String() + "/core/auth/captcha/image/" + captcha0 + "/"
+		for _, img := range page.images {
+			if strings.Contains(img["src"], captcha0) {
+				if u, err := r.Request.URL.Parse(img["src"]); err == nil {
+					captchaImg = u.String()
+				}
+				break
+			}
+		}
 	}
 
 	return &LoginPage{
-		csrftoken:    csrftoken,
-		rsaPublicKey: rsaPublicKey,
-		captcha0:     captcha0,
-		captchaImg:   captchaImg,
-		client:       c,
+		form:           form,
+		rsaPublicKey:   rsaPublicKey,
+		passwordScheme: scheme,
+		captchaImg:     captchaImg,
+		client:         c,
 	}, nil
 }
 
+// publicKeyCookie reads rsa public key set as jms_public_key cookie, which
+// is pem encoded in base64 and may be quoted
+func (c *Client) publicKeyCookie(u *url.URL) (string, bool) {
+	if c.Jar == nil {
+		return "", false
+	}
+	for _, cookie := range c.Jar.Cookies(u) {
+		if cookie.Name != "jms_public_key" {
+			continue
+		}
+		pemText, err := base64.StdEncoding.DecodeString(strings.Trim(cookie.Value, `"`))
+		if err != nil {
+			return "", false
+		}
+		return string(pemText), true
+	}
+	return "", false
+}
+
 // LoginPage store infomation about login page
 type LoginPage struct {
-	csrftoken    string
-	rsaPublicKey *rsa.PublicKey
-	captcha0     string
-	captchaImg   string
-	client       *Client
+	form           *htmlForm
+	rsaPublicKey   *rsa.PublicKey
+	passwordScheme passwordScheme
+	captchaImg     string
+	client         *Client
 }
 
 // HasCaptcha indicate this page contain captcha
 func (lp *LoginPage) HasCaptcha() bool {
-	return lp.captcha0 != ""
+	return lp.captchaImg != ""
 }
 
+// FetchCaptcha downloads captcha image
 func (lp *LoginPage) FetchCaptcha() ([]byte, error) {
-	u := lp.client.endpoint.String() + "/core/auth/captcha/image/" + lp.captcha0 + "/"
+	return lp.FetchCaptchaContext(context.Background())
+}
 
-	r, err := lp.client.Get(u)
+// FetchCaptchaContext is FetchCaptcha bound to ctx
+func (lp *LoginPage) FetchCaptchaContext(ctx context.Context) ([]byte, error) {
+	ctx, cancel := lp.client.requestContext(ctx)
+	defer cancel()
+	r, err := lp.client.get(ctx, lp.captchaImg)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	content, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return nil, err
 	}
 	if r.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to fetch captcha: %s", r.Status)
+		return nil, newAPIError(r, content)
 	}
+	return content, nil
+}
 
-	return ioutil.ReadAll(r.Body)
+// RefreshCaptcha replaces captcha of the page with a new one, like
+// clicking on the image in browser, call FetchCaptcha to get its image
+func (lp *LoginPage) RefreshCaptcha() error {
+	return lp.RefreshCaptchaContext(context.Background())
 }
 
-// ErrLoginFailed indicate authentication error
+// RefreshCaptchaContext is RefreshCaptcha bound to ctx
+func (lp *LoginPage) RefreshCaptchaContext(ctx context.Context) error {
+	c := lp.client
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint.String()+"/core/auth/captcha/refresh/", nil)
+	if err != nil {
+		return err
+	}
+	// django-simple-captcha only answers ajax requests
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	r, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Key      string `json:"key"`
+		ImageURL string `json:"image_url"`
+	}
+	if err := decodeJSONResponse(r, &result); err != nil {
+		return fmt.Errorf("failed to refresh captcha: %w", err)
+	}
+	img, err := r.Request.URL.Parse(result.ImageURL)
+	if err != nil || result.Key == "" {
+		return fmt.Errorf("failed to refresh captcha: unexpected response")
+	}
+
+	lp.form.fields.Set("captcha_0", result.Key)
+	lp.captchaImg = img.String()
+	return nil
+}
+
+// ErrLoginFailed indicate authentication error, it's also returned by
+// Submit when OTP is required, see LoginResult.HasOTP
 var ErrLoginFailed = errors.New("ErrLoginFailed")
 
 // Submit submits login form to Jumpserver
 func (lp *LoginPage) Submit(username, password, captcha string) (*LoginResult, error) {
-	form := url.Values{}
-	form.Set("csrfmiddlewaretoken", lp.csrftoken)
-	form.Set("username", username)
+	return lp.SubmitContext(context.Background(), username, password, captcha)
+}
 
-	encryptedPassword, err := rsa.EncryptPKCS1v15(
-		rand.Reader, lp.rsaPublicKey, []byte(password))
+// SubmitContext is Submit bound to ctx
+func (lp *LoginPage) SubmitContext(ctx context.Context, username, password, captcha string) (*LoginResult, error) {
+	encryptedPassword, err := encryptPassword(lp.passwordScheme, lp.rsaPublicKey, password)
 	if err != nil {
 		return nil, err
 	}
 
-	form.Set("password", base64.StdEncoding.EncodeToString(encryptedPassword))
+	values := map[string]string{
+		"username": username,
+		"password": encryptedPassword,
+	}
 	if captcha != "" {
-		form.Set("captcha_0", lp.captcha0)
-		form.Set("captcha_1", captcha)
+		values["captcha_1"] = captcha
 	}
 
-	r, err := lp.client.PostForm(lp.client.endpoint.String()+"/core/auth/login/", form)
+	return lp.client.submitLoginForm(ctx, "login", lp.form, values)
+}
+
+// submitLoginForm submits form of a login step with values filled in, and
+// figures out where it landed
+func (c *Client) submitLoginForm(ctx context.Context, step string, form *htmlForm, values map[string]string) (*LoginResult, error) {
+	data := url.Values{}
+	for k, v := range form.fields {
+		data[k] = v
+	}
+	for k, v := range values {
+		data.Set(k, v)
+	}
+
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", form.action.String(), strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -156,22 +380,32 @@ func (lp *LoginPage) Submit(username, password, captcha string) (*LoginResult, e
 	if err != nil {
 		return nil, err
 	}
-	text := string(content)
 
 	if r.StatusCode != 200 {
-		return nil, fmt.Errorf("submit login form got %s", r.Status)
+		return nil, newAPIError(r, content)
 	}
 
-	if r.Request.URL.Path != "/" {
-		if r.Request.URL.Path == "/core/auth/login/otp/" {
-			m := regexp.MustCompile(`name="csrfmiddlewaretoken"\s*?value="(.+?)"`).FindStringSubmatch(text)
-			if len(m) == 0 {
-				return nil, fmt.Errorf("failed to get csrftoken")
-			}
-			csrftoken := m[1]
-			return &LoginResult{client: lp.client, hasOTP: true, csrftoken: csrftoken}, ErrLoginFailed
+	page, err := parsePage(r.Request.URL, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if otpForm := page.formWith("otp_code"); otpForm != nil {
+		if !otpForm.has("csrfmiddlewaretoken") {
+			return nil, &PageError{Page: "otp page", Missing: "csrfmiddlewaretoken"}
 		}
-		return &LoginResult{}, ErrLoginFailed
+		lr := &LoginResult{client: c, hasOTP: true, form: otpForm}
+		if step == "otp" {
+			return lr, newLoginError(step, page.errors)
+		}
+		// password accepted, OTP is asked next
+		return lr, ErrLoginFailed
+	}
+	if page.formWith("username", "password") != nil || strings.HasPrefix(r.Request.URL.Path, "/core/auth/login/") {
+		if step == "otp" {
+			return &LoginResult{}, &LoginError{Reason: ErrLoginRestart, Message: strings.Join(page.errors, " ")}
+		}
+		return &LoginResult{}, newLoginError(step, page.errors)
 	}
 
 	return &LoginResult{}, nil
@@ -179,55 +413,38 @@ func (lp *LoginPage) Submit(username, password, captcha string) (*LoginResult, e
 
 // LoginResult stores result of submit result of login page
 type LoginResult struct {
-	client    *Client
-	hasOTP    bool
-	csrftoken string
+	client *Client
+	hasOTP bool
+	form   *htmlForm
 }
 
+// HasOTP tells whether OTP is asked next, it's false on nil result
 func (lr *LoginResult) HasOTP() bool {
-	return lr.hasOTP
+	return lr != nil && lr.hasOTP
 }
 
 func (lr *LoginResult) SubmitOTP(otp string) (*LoginResult, error) {
-	form := url.Values{}
-	form.Set("csrfmiddlewaretoken", lr.csrftoken)
-	form.Set("otp_code", otp)
-
-	r, err := lr.client.PostForm(lr.client.endpoint.String()+"/core/auth/login/otp/", form)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
-
-	content, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
-	}
-	text := string(content)
+	return lr.SubmitOTPContext(context.Background(), otp)
+}
 
-	if r.StatusCode != 200 {
-		return nil, fmt.Errorf("submit otp form got %s", r.Status)
+// SubmitOTPContext is SubmitOTP bound to ctx
+func (lr *LoginResult) SubmitOTPContext(ctx context.Context, otp string) (*LoginResult, error) {
+	if !lr.HasOTP() {
+		return nil, fmt.Errorf("no OTP step to submit")
 	}
-
-	if r.Request.URL.Path != "/" {
-		if r.Request.URL.Path == "/core/auth/login/otp/" {
-			m := regexp.MustCompile(`name="csrfmiddlewaretoken"\s*?value="(.+?)"`).FindStringSubmatch(text)
-			if len(m) == 0 {
-				return nil, fmt.Errorf("failed to get csrftoken")
-			}
-			csrftoken := m[1]
-			return &LoginResult{hasOTP: true, csrftoken: csrftoken}, ErrLoginFailed
-		}
-		return &LoginResult{}, ErrLoginFailed
-	}
-
-	return &LoginResult{}, nil
+	return lr.client.submitLoginForm(ctx, "otp", lr.form, map[string]string{"otp_code": otp})
 }
 
+// Asset is a host managed by Jumpserver
 type Asset struct {
-	ID       string   `json:"id"`
-	Hostname string   `json:"hostname"`
-	Nodes    []string `json:"nodes_display"`
+	ID        string   `json:"id"`
+	Hostname  string   `json:"hostname"`
+	IP        string   `json:"ip"`
+	Platform  string   `json:"platform"`
+	Protocols []string `json:"protocols"`
+	Comment   string   `json:"comment"`
+	IsActive  bool     `json:"is_active"`
+	Nodes     []string `json:"nodes_display"`
 }
 
 type SystemUser struct {
@@ -236,95 +453,130 @@ type SystemUser struct {
 	Username string `json:"username"`
 }
 
+// FindAssetByHostname looks up asset with exactly the hostname
 func (c *Client) FindAssetByHostname(hostname string) (Asset, bool, error) {
+	return c.FindAssetByHostnameContext(context.Background(), hostname)
+}
+
+// FindAssetByHostnameContext is FindAssetByHostname bound to ctx
+func (c *Client) FindAssetByHostnameContext(ctx context.Context, hostname string) (Asset, bool, error) {
 	if hostname == "" {
 		return Asset{}, false, fmt.Errorf("hostname must not be empty")
 	}
 
-	req, err := http.NewRequest("GET", c.endpoint.String()+"/api/v1/assets/assets/", nil)
-	if err != nil {
-		return Asset{}, false, err
+	it := c.iterAssets(ctx, assetFilter{hostname: hostname})
+	for it.Next() {
+		if it.Asset().Hostname == hostname {
+			return it.Asset(), true, nil
+		}
 	}
-	query := url.Values{}
-	query.Set("hostname", hostname)
-	query.Set("offset", "0")
-	query.Set("limit", "100")
-	query.Set("display", "1")
-	query.Set("draw", "1")
-	req.URL.RawQuery = query.Encode()
+	return Asset{}, false, it.Err()
+}
 
-	r, err := c.Do(req)
-	if err != nil {
-		return Asset{}, false, err
-	}
-	defer r.Body.Close()
-	content, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return Asset{}, false, err
-	}
+// SearchAsset returns all assets matching keyword in hostname, ip or comment
+func (c *Client) SearchAsset(keyword string) ([]Asset, error) {
+	return c.SearchAssetContext(context.Background(), keyword)
+}
 
-	if r.StatusCode != 200 {
-		return Asset{}, false, fmt.Errorf("api request failed: %s", r.Status)
+// SearchAssetContext is SearchAsset bound to ctx
+func (c *Client) SearchAssetContext(ctx context.Context, keyword string) ([]Asset, error) {
+	var assets []Asset
+	it := c.IterAssetsContext(ctx, keyword)
+	for it.Next() {
+		assets = append(assets, it.Asset())
 	}
+	return assets, it.Err()
+}
 
-	var result struct {
-		Results []Asset `json:"results"`
-	}
+// IterAssets walks through assets matching keyword page by page, an empty
+// keyword matches all assets
+func (c *Client) IterAssets(keyword string) *AssetIterator {
+	return c.IterAssetsContext(context.Background(), keyword)
+}
 
-	if err := json.Unmarshal(content, &result); err != nil {
-		return Asset{}, false, err
-	}
+// IterAssetsContext is IterAssets, pages are fetched with ctx
+func (c *Client) IterAssetsContext(ctx context.Context, keyword string) *AssetIterator {
+	return c.iterAssets(ctx, assetFilter{search: keyword})
+}
 
-	if len(result.Results) == 0 {
-		return Asset{}, false, nil
-	}
+func (c *Client) iterAssets(ctx context.Context, filter assetFilter) *AssetIterator {
+	return &AssetIterator{ctx: ctx, client: c, filter: filter, limit: 100, more: true}
+}
 
-	if result.Results[0].Hostname != hostname {
-		return Asset{}, false, fmt.Errorf(
-			"expected asset %s, but got %s", hostname, result.Results[0].Hostname)
+// AssetIterator fetches assets lazily, use it like bufio.Scanner:
+//
+//	it := c.IterAssets("web")
+//	for it.Next() {
+//		fmt.Println(it.Asset().Hostname)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type AssetIterator struct {
+	ctx    context.Context
+	client *Client
+	filter assetFilter
+	offset int
+	limit  int
+	more   bool
+
+	page []Asset
+	cur  Asset
+	err  error
+}
+
+// Next advances to next asset, fetching next page if needed. It returns
+// false when assets are exhausted or an error occurred
+func (it *AssetIterator) Next() bool {
+	if it.err != nil {
+		return false
 	}
-	return result.Results[0], true, nil
+	if len(it.page) == 0 {
+		if !it.more {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
 }
 
-// func (c *Client) SearchAsset(keyword string) ([]Asset, error) {
-// 	var (
-// 		assets []Asset
-// 		offset int = 0
-// 		limit  int = 100
-// 	)
+// Asset returns current asset
+func (it *AssetIterator) Asset() Asset {
+	return it.cur
+}
 
-// 	for {
-// 		u := fmt.Sprintf(
-// 			c.endpoint.String()+"/api/v1/assets/assets/?offset=%d&limit=%d&display=1&draw=1",
-// 			offset, limit,
-// 		)
-// 		r, err := c.Get(u)
-// 		if err != nil {
-// 			return nil, err
-// 		}
+// Err returns the error stopped the iteration, if any
+func (it *AssetIterator) Err() error {
+	return it.err
+}
 
-// 	}
+func (it *AssetIterator) fetch() error {
+	assets, count, err := it.client.api.listAssets(it.ctx, it.client, it.filter, it.offset, it.limit)
+	if err != nil {
+		return err
+	}
 
-// 	return assets, nil
-// }
+	it.page = assets
+	it.offset += len(assets)
+	it.more = len(assets) > 0 && it.offset < count
+	return nil
+}
 
+// ListSystemUsers returns system users could be used to log in asset, on
+// Jumpserver v3 they are accounts of asset
 func (c *Client) ListSystemUsers(assetID string) ([]SystemUser, error) {
-	u := fmt.Sprintf(c.endpoint.String()+"/api/v1/perms/users/assets/%s/system-users/", assetID)
-	r, err := c.Get(u)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
-	content, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
-	}
+	return c.ListSystemUsersContext(context.Background(), assetID)
+}
 
-	var result []SystemUser
-	if err := json.Unmarshal(content, &result); err != nil {
-		return nil, err
-	}
-	return result, nil
+// ListSystemUsersContext is ListSystemUsers bound to ctx
+func (c *Client) ListSystemUsersContext(ctx context.Context, assetID string) ([]SystemUser, error) {
+	return c.api.listSystemUsers(ctx, c, assetID)
 }
 
 type Message struct {
@@ -350,144 +602,96 @@ type WindowSize struct {
 
 // ConnectAsset connects to asset, opens a ternamal
 func (c *Client) ConnectAsset(targetID string, systemUserID string) error {
-	dailer := &websocket.Dialer{Jar: c.Jar}
-	scheme := "ws"
-	if c.endpoint.Scheme == "https" {
-		scheme = "wss"
-	}
-	u := fmt.Sprintf(
-		"%s://%s/koko/ws/terminal/?target_id=%s&type=asset&system_user_id=%s",
-		scheme, c.endpoint.Host, targetID, systemUserID,
-	)
-	ws, _, err := dailer.Dial(u, nil)
-	if err != nil {
-		return fmt.Errorf("failed to connect: %s", err)
-	}
-	defer fmt.Fprintln(os.Stderr, "Connection closed")
-	defer ws.Close()
-
-	return c.enterTty(targetID, ws)
+	return c.ConnectAssetContext(context.Background(), targetID, systemUserID)
 }
 
-func (c *Client) enterTty(targetID string, ws *websocket.Conn) error {
-	var firstMsg Message
-	if err := ws.ReadJSON(&firstMsg); err != nil {
-		return err
-	}
-
-	if firstMsg.Type != CONNECT {
-		return fmt.Errorf("Expected got CONNECT message, but got %s", firstMsg.Type)
-	}
-	cid := firstMsg.Id
-
+// ConnectAssetContext is ConnectAsset, cancelling ctx closes the terminal
+func (c *Client) ConnectAssetContext(ctx context.Context, targetID string, systemUserID string) error {
 	t, err := tty.Open()
 	if err != nil {
 		return err
 	}
 	defer t.Close()
 
-	clean, err := t.Raw()
+	w, h, err := t.Size()
 	if err != nil {
 		return err
 	}
-	defer clean()
 
-	w, h, err := t.Size()
+	s, err := c.OpenSessionContext(ctx, targetID, systemUserID, WindowSize{Cols: w, Rows: h})
 	if err != nil {
 		return err
 	}
+	defer fmt.Fprintln(os.Stderr, "Connection closed")
+	defer s.Close()
 
-	if err := ws.WriteJSON(&Message{
-		Id:   cid,
-		Type: TERMINALINIT,
-		Data: fmt.Sprintf(`{"cols":%d,"rows":%d}`, w, h),
-	}); err != nil {
-		return err
+	stop := watchContext(ctx, s)
+	err = c.enterTty(t, s)
+	if cerr := stop(); cerr != nil {
+		return cerr
 	}
+	return err
+}
 
-	ttyInput := make(chan struct {
-		data []byte
-		err  error
-	})
+func (c *Client) enterTty(t *tty.TTY, s *Session) error {
+	clean, err := t.Raw()
+	if err != nil {
+		return err
+	}
+	defer clean()
 
+	resize := make(chan WindowSize)
 	go func() {
-		for {
-			data := make([]byte, 8*1024)
-			n, err := t.Input().Read(data)
-			ttyInput <- struct {
-				data []byte
-				err  error
-			}{data: data[:n], err: err}
-			if err != nil {
-				return
-			}
+		for ws := range t.SIGWINCH() {
+			resize <- WindowSize{Cols: ws.W, Rows: ws.H}
 		}
 	}()
 
-	wsInput := make(chan struct {
-		msg *Message
-		err error
-	})
+	out := &lastByteWriter{w: t.Output()}
+	if err := s.attach(resize, t.Input(), out); err != nil {
+		return err
+	}
+	if out.last != 0 && out.last != '\n' {
+		t.Output().WriteString("\r\n")
+	}
+	return nil
+}
 
-	go func() {
-		for {
-			msg := Message{}
-			err := ws.ReadJSON(&msg)
-			wsInput <- struct {
-				msg *Message
-				err error
-			}{msg: &msg, err: err}
-			if err != nil {
-				return
-			}
-		}
-	}()
+// AttachTerminal opens a terminal on asset and bridges it with in and out
+// until koko closes it. New window sizes are read from resize, which may
+// be nil if size never changes
+func (c *Client) AttachTerminal(targetID, systemUserID string, size WindowSize, resize <-chan WindowSize, in io.Reader, out io.Writer) error {
+	return c.AttachTerminalContext(context.Background(), targetID, systemUserID, size, resize, in, out)
+}
+
+// AttachTerminalContext is AttachTerminal, cancelling ctx closes the
+// terminal
+func (c *Client) AttachTerminalContext(ctx context.Context, targetID, systemUserID string, size WindowSize, resize <-chan WindowSize, in io.Reader, out io.Writer) error {
+	s, err := c.OpenSessionContext(ctx, targetID, systemUserID, size)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
 
-	sigwatch := t.SIGWINCH()
+	stop := watchContext(ctx, s)
+	err = s.attach(resize, in, out)
+	if cerr := stop(); cerr != nil {
+		return cerr
+	}
+	return err
+}
 
-	lastOutput := ""
+// lastByteWriter remembers last byte written, so we can tell whether
+// cursor is at beginning of line
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
 
-	for {
-		select {
-		case s := <-sigwatch:
-			if err := ws.WriteJSON(&Message{
-				Id:   cid,
-				Type: TERMINALRESIZE,
-				Data: fmt.Sprintf(`{"cols":%d,"rows":%d}`, s.W, s.H),
-			}); err != nil {
-				return err
-			}
-		case ti := <-ttyInput:
-			if ti.err != nil {
-				return ti.err
-			}
-			if err := ws.WriteJSON(&Message{
-				Id:   cid,
-				Type: TERMINALDATA,
-				Data: string(ti.data),
-			}); err != nil {
-				return err
-			}
-		case wi := <-wsInput:
-			if wi.err != nil {
-				return wi.err
-			}
-			switch wi.msg.Type {
-			case TERMINALDATA:
-				if _, err := t.Output().Write([]byte(wi.msg.Data)); err != nil {
-					return err
-				}
-				lastOutput = wi.msg.Data
-			case CLOSE:
-				if lastOutput[len(lastOutput)-1] != '\n' {
-					t.Output().WriteString("\r\n")
-				}
-				return nil
-			case PING:
-				if err := ws.WriteJSON(&wi.msg); err != nil {
-					return wi.err
-				}
-			}
-		}
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.last = p[n-1]
 	}
+	return n, err
 }
@@ -1,18 +1,17 @@
 package jmsh
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 )
 
-const (
-	endpoint = "http://127.0.0.1:8080"
-	username = "admin"
-	password = "zeqing"
-	otp      = "812028"
-)
-
-func login(t *testing.T) *Client {
-	c, err := NewClient(endpoint)
+func login(t *testing.T, fs *fakeJumpserver) *Client {
+	c, err := NewClient(fs.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -24,31 +23,154 @@ func login(t *testing.T) *Client {
 
 	var captcha string
 	if loginPage.HasCaptcha() {
-		t.Fatal("encounter captcha!")
+		captcha = fs.captcha
 	}
 
-	lr, err := loginPage.Submit(username, password, captcha)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if lr.HasOTP() {
-		if lr, err = lr.SubmitOTP(otp); err != nil {
+	lr, err := loginPage.Submit(fs.username, fs.password, captcha)
+	if lr != nil && lr.HasOTP() {
+		if lr, err = lr.SubmitOTP(fs.otp); err != nil {
 			t.Fatal(err)
 		}
+	} else if err != nil {
+		t.Fatal(err)
 	}
 	return c
 }
 
 func TestLogin(t *testing.T) {
-	c := login(t)
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
+
+	ok, err := c.IsLoggedIn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected to be logged in")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
 
-	for _, cookie := range c.Client.Jar.Cookies(c.endpoint) {
-		println(cookie.String())
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := c.IsLoggedIn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected to be logged out")
+	}
+}
+
+func TestLoginWithOTP(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.otp = "812028"
+	c := login(t, fs)
+
+	ok, err := c.IsLoggedIn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected to be logged in")
+	}
+}
+
+func TestLoginWithCaptcha(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.captcha = "abcd"
+
+	c, err := NewClient(fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lp.HasCaptcha() {
+		t.Fatal("expected captcha")
+	}
+	img, err := lp.FetchCaptcha()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(img, []byte("\x89PNG")) {
+		t.Fatalf("unexpected captcha image %q", img)
+	}
+
+	if _, err := lp.Submit(fs.username, fs.password, "wrong"); !errors.Is(err, ErrCaptchaInvalid) {
+		t.Fatalf("expected ErrCaptchaInvalid, got %v", err)
+	}
+	login(t, fs)
+}
+
+func TestRefreshCaptcha(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.captcha = "abcd"
+
+	c, err := NewClient(fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := lp.captchaImg
+	if err := lp.RefreshCaptcha(); err != nil {
+		t.Fatal(err)
+	}
+	if lp.captchaImg == old {
+		t.Fatal("expected a new captcha image")
+	}
+	if _, err := lp.FetchCaptcha(); err != nil {
+		t.Fatal(err)
+	}
+	// server only accepts the refreshed captcha now
+	if _, err := lp.Submit(fs.username, fs.password, fs.captcha); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginFailed(t *testing.T) {
+	fs := newFakeJumpserver(t)
+
+	c, err := NewClient(fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr, err := lp.Submit(fs.username, "wrong", "")
+	if !errors.Is(err, ErrBadCredentials) || !errors.Is(err, ErrLoginFailed) {
+		t.Fatalf("expected ErrBadCredentials, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "The username or password you entered is incorrect") {
+		t.Fatalf("expected server message, got %q", err)
+	}
+	if lr.HasOTP() {
+		t.Fatal("unexpected OTP")
+	}
+
+	ok, err := c.IsLoggedIn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected not logged in")
 	}
 }
 
 func TestFindAssetByHostname(t *testing.T) {
-	c := login(t)
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
 
 	asset, ok, err := c.FindAssetByHostname("node1")
 	if err != nil {
@@ -57,28 +179,175 @@ func TestFindAssetByHostname(t *testing.T) {
 	if !ok {
 		t.Fatal("no found asset")
 	}
-	t.Logf("asset: %#v", asset)
+	if asset.ID != "asset-1" || asset.IP != "172.16.222.101" {
+		t.Fatalf("unexpected asset: %#v", asset)
+	}
+
+	_, ok, err = c.FindAssetByHostname("node3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected no asset found")
+	}
+}
+
+func TestSearchAsset(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.addAssets(250)
+	c := login(t, fs)
+
+	assets, err := c.SearchAsset("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 252 {
+		t.Fatalf("expected 252 assets, got %d", len(assets))
+	}
+
+	assets, err = c.SearchAsset("host1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 100 {
+		t.Fatalf("expected 100 assets, got %d", len(assets))
+	}
 }
 
 func TestListSystemUsers(t *testing.T) {
-	c := login(t)
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
 
-	asset, ok, err := c.FindAssetByHostname("node1")
+	users, err := c.ListSystemUsers("asset-1")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !ok {
-		t.Fatal("no found asset")
+	if len(users) != 1 || users[0].Username != "root" {
+		t.Fatalf("unexpected system users: %#v", users)
+	}
+}
+
+func TestSession(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
+
+	s, err := c.OpenSession("asset-1", "su-root", WindowSize{Cols: 80, Rows: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Resize(100, 30); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(s, "exit\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Welcome", "resized 100x30", "exit\r\n", "logout"} {
+		if !strings.Contains(string(output), want) {
+			t.Fatalf("expected %q in output %q", want, output)
+		}
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session not done")
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecAsset(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	c := login(t, fs)
+
+	cases := []struct {
+		command string
+		output  string
+		status  int
+	}{
+		{"uptime", " 10:00:00 up 1 day\n", 0},
+		{"printf hi", "hi", 0},
+		{"false", "", 1},
+	}
+	for _, tc := range cases {
+		var out bytes.Buffer
+		status, err := c.ExecAsset("asset-1", "su-root", tc.command, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tc.status {
+			t.Fatalf("%s: expected status %d, got %d", tc.command, tc.status, status)
+		}
+		if out.String() != tc.output {
+			t.Fatalf("%s: expected output %q, got %q", tc.command, tc.output, out.String())
+		}
+	}
+}
+
+func TestSubmitOTPRetry(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.otp = "812028"
+
+	c, err := NewClient(fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr, err := lp.Submit(fs.username, fs.password, "")
+	if err != ErrLoginFailed || !lr.HasOTP() {
+		t.Fatalf("expected OTP required, got %v", err)
 	}
-	t.Logf("asset: %#v", asset)
 
-	users, err := c.ListSystemUsers(asset.ID)
+	lr, err = lr.SubmitOTP("000000")
+	if !errors.Is(err, ErrOTPInvalid) || !lr.HasOTP() {
+		t.Fatalf("expected OTP rejected, got %v", err)
+	}
+	if _, err := lr.SubmitOTP(fs.otp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubmitOTPBackToLogin(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.otp = "812028"
+
+	c, err := NewClient(fs.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("system_user of %s: %#v", asset.ID, users)
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr, err := lp.Submit(fs.username, fs.password, "")
+	if !lr.HasOTP() {
+		t.Fatalf("expected OTP required, got %v", err)
+	}
 
-	if len(users) == 0 {
-		t.Fatal("no system user found")
+	// pending login timed out, OTP page redirects to login page
+	fs.mu.Lock()
+	fs.pending = map[string]bool{}
+	fs.mu.Unlock()
+
+	lr, err = lr.SubmitOTP(fs.otp)
+	if !errors.Is(err, ErrLoginRestart) || !errors.Is(err, ErrLoginFailed) || errors.Is(err, ErrOTPInvalid) {
+		t.Fatalf("expected login to start over, got %v", err)
+	}
+	if lr.HasOTP() {
+		t.Fatal("expected no OTP step on login page")
+	}
+	if _, err := lr.SubmitOTP(fs.otp); err == nil {
+		t.Fatal("expected error submitting OTP without OTP step")
 	}
 }
@@ -0,0 +1,79 @@
+package jmsh
+
+import (
+	"errors"
+	"strings"
+)
+
+// reasons of login failure, LoginError matches them with errors.Is
+var (
+	ErrBadCredentials  = errors.New("wrong username or password")
+	ErrCaptchaInvalid  = errors.New("invalid captcha")
+	ErrOTPInvalid      = errors.New("invalid OTP code")
+	ErrAccountLocked   = errors.New("account locked")
+	ErrIPBlocked       = errors.New("address blocked")
+	ErrPasswordExpired = errors.New("password expired")
+	// ErrLoginRestart is OTP step sent back to login page, e.g. it timed
+	// out, the login has to start over from password
+	ErrLoginRestart = errors.New("login has to start over")
+)
+
+// LoginError is returned by Submit and SubmitOTP when Jumpserver rejects
+// the login, Reason is one of ErrBadCredentials, ErrCaptchaInvalid and
+// so on, or ErrLoginFailed if the message is not recognized
+type LoginError struct {
+	Reason error
+	// Message is what Jumpserver shows on the page, could be empty
+	Message string
+}
+
+func (e *LoginError) Error() string {
+	if e.Message == "" {
+		return e.Reason.Error()
+	}
+	return e.Message
+}
+
+// Is makes errors.Is(err, ErrLoginFailed) hold for every LoginError
+func (e *LoginError) Is(target error) bool {
+	return target == ErrLoginFailed || target == e.Reason
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Reason
+}
+
+// loginErrorKeywords maps phrases of Jumpserver messages, both English and
+// Chinese, to reasons. Order matters, the first match wins
+var loginErrorKeywords = []struct {
+	reason   error
+	keywords []string
+}{
+	{ErrIPBlocked, []string{"address has been locked", "IP 已被锁定", "ip is not allowed", "IP 不被允许"}},
+	{ErrAccountLocked, []string{"account has been locked", "账号已被锁定", "is inactive", "disabled", "已禁用"}},
+	{ErrPasswordExpired, []string{"password has expired", "password expired", "密码已过期"}},
+	{ErrOTPInvalid, []string{"mfa", "otp"}},
+	{ErrCaptchaInvalid, []string{"captcha", "验证码"}},
+	{ErrBadCredentials, []string{"username or password", "用户名或密码", "password"}},
+}
+
+// newLoginError builds LoginError of a rejected login step from messages
+// shown on the page
+func newLoginError(step string, messages []string) *LoginError {
+	message := strings.Join(messages, " ")
+	lower := strings.ToLower(message)
+	for _, k := range loginErrorKeywords {
+		for _, keyword := range k.keywords {
+			if strings.Contains(lower, strings.ToLower(keyword)) {
+				return &LoginError{Reason: k.reason, Message: message}
+			}
+		}
+	}
+
+	reason := ErrLoginFailed
+	if step == "otp" {
+		// nothing else could be wrong when OTP page is shown again
+		reason = ErrOTPInvalid
+	}
+	return &LoginError{Reason: reason, Message: message}
+}
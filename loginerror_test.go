@@ -0,0 +1,45 @@
+package jmsh
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoginError(t *testing.T) {
+	fs := newFakeJumpserver(t)
+
+	cases := []struct {
+		message string
+		reason  error
+	}{
+		{"The account has been locked (please contact admin to unlock it or try again after 30 minutes)", ErrAccountLocked},
+		{"The address has been locked (please contact admin to unlock it or try again after 30 minutes)", ErrIPBlocked},
+		{"Your password has expired, please reset before logging in", ErrPasswordExpired},
+		{"账号已被锁定（请联系管理员解锁 或 30分钟后重试）", ErrAccountLocked},
+		{"您输入的用户名或密码不正确，请重新输入。 您还可以尝试 4 次（账号将被临时 锁定 30 分钟）", ErrBadCredentials},
+		{"Something else went wrong", ErrLoginFailed},
+	}
+	for _, tc := range cases {
+		fs.loginError = tc.message
+
+		c, err := NewClient(fs.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lp, err := c.FetchLoginPage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = lp.Submit(fs.username, fs.password, "")
+		var le *LoginError
+		if !errors.As(err, &le) {
+			t.Fatalf("%s: expected LoginError, got %v", tc.message, err)
+		}
+		if le.Reason != tc.reason || le.Message != tc.message {
+			t.Fatalf("%s: unexpected %v (%v)", tc.message, le.Reason, le.Message)
+		}
+		if !errors.Is(err, ErrLoginFailed) {
+			t.Fatalf("%s: expected to be ErrLoginFailed", tc.message)
+		}
+	}
+}
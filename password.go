@@ -0,0 +1,87 @@
+package jmsh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// passwordScheme is how login page expects password to be encrypted
+type passwordScheme int
+
+const (
+	// schemeRSA encrypts password with rsaPublicKey directly, used by
+	// older login pages
+	schemeRSA passwordScheme = iota
+	// schemeHybrid encrypts password with a random AES key, and sends the
+	// key wrapped with RSA along with it, as "<rsa(key)>:<aes(password)>"
+	schemeHybrid
+)
+
+// encryptPassword encrypts password the way login page does in browser
+func encryptPassword(scheme passwordScheme, pub *rsa.PublicKey, password string) (string, error) {
+	if scheme == schemeRSA {
+		return rsaEncrypt(pub, []byte(password))
+	}
+
+	key, err := randomAESKey()
+	if err != nil {
+		return "", err
+	}
+	keyCipher, err := rsaEncrypt(pub, key)
+	if err != nil {
+		return "", err
+	}
+	passwordCipher, err := aesECBEncrypt(key, []byte(password))
+	if err != nil {
+		return "", err
+	}
+	return keyCipher + ":" + passwordCipher, nil
+}
+
+func rsaEncrypt(pub *rsa.PublicKey, plain []byte) (string, error) {
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, pub, plain)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// aesKeyChars are what browser side picks AES key from, the key is sent
+// as text so it has to be printable
+const aesKeyChars = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func randomAESKey() ([]byte, error) {
+	key := make([]byte, 16)
+	max := big.NewInt(int64(len(aesKeyChars)))
+	for i := range key {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, err
+		}
+		key[i] = aesKeyChars[n.Int64()]
+	}
+	return key, nil
+}
+
+// aesECBEncrypt matches CryptoJS.AES.encrypt with ECB mode and zero
+// padding, which is what Jumpserver decrypts on server side
+func aesECBEncrypt(key, plain []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	size := block.BlockSize()
+	if len(plain)%size != 0 {
+		plain = append(plain, bytes.Repeat([]byte{0}, size-len(plain)%size)...)
+	}
+
+	encrypted := make([]byte, len(plain))
+	for i := 0; i < len(plain); i += size {
+		block.Encrypt(encrypted[i:i+size], plain[i:i+size])
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
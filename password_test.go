@@ -0,0 +1,49 @@
+package jmsh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptPasswordHybrid(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.hybrid = true
+
+	// 16 bytes long password needs no padding
+	for _, password := range []string{"zeqing", "0123456789abcdef", "长一点的密码 with spaces"} {
+		text, err := encryptPassword(schemeHybrid, &fakeKey.PublicKey, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(text, ":") != 1 {
+			t.Fatalf("unexpected cipher text %q", text)
+		}
+		decrypted, err := fs.decryptPassword(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != password {
+			t.Fatalf("expected %q, got %q", password, decrypted)
+		}
+	}
+}
+
+func TestLoginHybrid(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	fs.hybrid = true
+
+	c, err := NewClient(fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lp.passwordScheme != schemeHybrid {
+		t.Fatal("expected hybrid password scheme")
+	}
+	if _, err := lp.Submit(fs.username, fs.password, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package jmsh
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Session is a terminal opened on an asset. Reading from it returns
+// terminal output, writing to it sends input. Output must be consumed,
+// otherwise the session stalls
+type Session struct {
+	term *terminal
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+	done chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// OpenSession opens a terminal of given size on asset as system user
+func (c *Client) OpenSession(assetID, systemUserID string, size WindowSize) (*Session, error) {
+	return c.OpenSessionContext(context.Background(), assetID, systemUserID, size)
+}
+
+// OpenSessionContext is OpenSession, ctx bounds opening the terminal only,
+// call Close to end the session
+func (c *Client) OpenSessionContext(ctx context.Context, assetID, systemUserID string, size WindowSize) (*Session, error) {
+	term, err := c.openTerminal(ctx, assetID, systemUserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := term.init(size.Cols, size.Rows); err != nil {
+		term.close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	s := &Session{term: term, pr: pr, pw: pw, done: make(chan struct{})}
+	go s.loop()
+	return s, nil
+}
+
+func (s *Session) loop() {
+	defer close(s.done)
+	for {
+		data, err := s.term.recv()
+		if err != nil {
+			s.mu.Lock()
+			if err != io.EOF && !s.closed {
+				s.err = err
+			}
+			s.mu.Unlock()
+			s.pw.CloseWithError(s.Err())
+			return
+		}
+		if _, err := s.pw.Write([]byte(data)); err != nil {
+			// reader side closed by Close
+			return
+		}
+	}
+}
+
+// Read reads terminal output, it returns io.EOF once session ends
+func (s *Session) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+// Write sends p as terminal input
+func (s *Session) Write(p []byte) (int, error) {
+	if err := s.term.send(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize tells remote terminal new window size
+func (s *Session) Resize(cols, rows int) error {
+	return s.term.resize(cols, rows)
+}
+
+// Done returns a channel closed when session ends
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error ended the session, it's nil if session is still
+// alive, closed by Close or closed by koko
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the session
+func (s *Session) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	err := s.term.close()
+	s.pr.Close()
+	return err
+}
+
+// attach bridges session with in and out until session ends
+func (s *Session) attach(resize <-chan WindowSize, in io.Reader, out io.Writer) error {
+	errc := make(chan error, 2)
+
+	go func() {
+		// on EOF of input keep receiving output until koko closes
+		if _, err := io.Copy(s, in); err != nil {
+			errc <- err
+		}
+	}()
+
+	go func() {
+		_, err := io.Copy(out, s)
+		errc <- err
+	}()
+
+	for {
+		select {
+		case size := <-resize:
+			if err := s.Resize(size.Cols, size.Rows); err != nil {
+				return err
+			}
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+			return s.Err()
+		}
+	}
+}
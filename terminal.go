@@ -0,0 +1,168 @@
+package jmsh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// terminal speaks koko's terminal protocol over websocket, it knows
+// nothing about where input comes from and output goes to
+type terminal struct {
+	ws    *websocket.Conn
+	cid   string
+	trace *tracer
+
+	// websocket supports only one concurrent writer
+	wmu sync.Mutex
+}
+
+// openTerminal connects to koko and waits for CONNECT message, call init
+// afterwards to start the terminal
+func (c *Client) openTerminal(ctx context.Context, targetID string, systemUserID string) (*terminal, error) {
+	var ws *websocket.Conn
+	err := c.withReauth(func() error {
+		uri, err := c.api.terminalURI(ctx, c, targetID, systemUserID)
+		if err != nil {
+			return err
+		}
+		ws, err = c.dialWebsocket(ctx, uri)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var firstMsg Message
+	stop := watchContext(ctx, ws)
+	err = ws.ReadJSON(&firstMsg)
+	if cerr := stop(); cerr != nil {
+		return nil, cerr
+	}
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	c.trace.message("<", &firstMsg)
+
+	if firstMsg.Type != CONNECT {
+		ws.Close()
+		return nil, fmt.Errorf("Expected got CONNECT message, but got %s", firstMsg.Type)
+	}
+
+	return &terminal{ws: ws, cid: firstMsg.Id, trace: c.trace}, nil
+}
+
+// dialWebsocket connects to koko websocket at uri, which is path and query
+func (c *Client) dialWebsocket(ctx context.Context, uri string) (*websocket.Conn, error) {
+	dailer := &websocket.Dialer{
+		Jar:              c.Jar,
+		NetDialContext:   c.dialContext,
+		HandshakeTimeout: c.connectTimeout,
+		Proxy:            c.websocketProxy,
+		TLSClientConfig:  c.transport.TLSClientConfig,
+	}
+	scheme := "ws"
+	if c.endpoint.Scheme == "https" {
+		scheme = "wss"
+	}
+	u := fmt.Sprintf("%s://%s%s", scheme, c.endpoint.Host, uri)
+
+	header := http.Header{}
+	if c.auth != nil {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.auth.authorize(req); err != nil {
+			return nil, err
+		}
+		header = req.Header
+	}
+
+	if wsURL, err := url.Parse(u); err == nil {
+		c.trace.printf("ws > dial %s", redactURL(wsURL))
+	}
+	start := time.Now()
+	ws, r, err := dailer.DialContext(ctx, u, header)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if r != nil {
+		c.trace.printf("ws < dial %s in %s", r.Status, elapsed)
+		if r.StatusCode != http.StatusSwitchingProtocols {
+			traceHeader(c.trace, "ws <", r.Header)
+		}
+	} else if err != nil {
+		c.trace.printf("ws < dial failed after %s: %s", elapsed, err)
+	}
+	if err != nil {
+		if r != nil && (r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusForbidden ||
+			strings.Contains(r.Header.Get("Location"), "/core/auth/login/")) {
+			return nil, ErrSessionExpired
+		}
+		if r != nil && r.Request != nil {
+			// websocket dialer keeps first 1KB of body
+			content, _ := ioutil.ReadAll(r.Body)
+			return nil, newAPIError(r, content)
+		}
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	return ws, nil
+}
+
+func (t *terminal) write(msgType, data string) error {
+	msg := &Message{Id: t.cid, Type: msgType, Data: data}
+	t.trace.message(">", msg)
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	return t.ws.WriteJSON(msg)
+}
+
+func (t *terminal) init(cols, rows int) error {
+	return t.write(TERMINALINIT, fmt.Sprintf(`{"cols":%d,"rows":%d}`, cols, rows))
+}
+
+func (t *terminal) resize(cols, rows int) error {
+	return t.write(TERMINALRESIZE, fmt.Sprintf(`{"cols":%d,"rows":%d}`, cols, rows))
+}
+
+func (t *terminal) send(data []byte) error {
+	return t.write(TERMINALDATA, string(data))
+}
+
+// recv returns next chunk of terminal output, it answers PING by itself
+// and returns io.EOF once koko closes the terminal
+func (t *terminal) recv() (string, error) {
+	for {
+		var msg Message
+		if err := t.ws.ReadJSON(&msg); err != nil {
+			return "", err
+		}
+		t.trace.message("<", &msg)
+		switch msg.Type {
+		case TERMINALDATA:
+			return msg.Data, nil
+		case CLOSE:
+			return "", io.EOF
+		case PING:
+			t.trace.message(">", &msg)
+			t.wmu.Lock()
+			err := t.ws.WriteJSON(&msg)
+			t.wmu.Unlock()
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+func (t *terminal) close() error {
+	return t.ws.Close()
+}
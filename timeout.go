@@ -0,0 +1,86 @@
+package jmsh
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// default timeouts of Client, a hung Jumpserver shouldn't block forever
+const (
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultRequestTimeout = 30 * time.Second
+)
+
+// WithConnectTimeout bounds establishing a connection to Jumpserver,
+// including TLS and websocket handshakes. Zero means no limit
+func WithConnectTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		c.connectTimeout = d
+		return nil
+	}
+}
+
+// WithRequestTimeout bounds each API request. Terminal sessions and file
+// transfers are long-lived and only bounded by context. Zero means no
+// limit
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		c.requestTimeout = d
+		return nil
+	}
+}
+
+func (c *Client) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: c.connectTimeout, KeepAlive: 30 * time.Second}
+	return d.DialContext(ctx, network, addr)
+}
+
+// requestContext bounds an API request with request timeout
+func (c *Client) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.requestTimeout)
+}
+
+// get is http.Client.Get bound to ctx
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// watchContext closes closer once ctx is done, until stop is called. stop
+// returns ctx.Err() if closer was closed because of ctx
+func watchContext(ctx context.Context, closer io.Closer) (stop func() error) {
+	if ctx.Done() == nil {
+		return func() error { return nil }
+	}
+
+	stopped := make(chan struct{})
+	exited := make(chan struct{})
+	fired := false
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			closer.Close()
+			fired = true
+		case <-stopped:
+		}
+	}()
+
+	return func() error {
+		close(stopped)
+		<-exited
+		if fired {
+			return ctx.Err()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+package jmsh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// hangingServer never answers until test ends
+func hangingServer(t *testing.T) *httptest.Server {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		ts.Close()
+	})
+	return ts
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ts := hangingServer(t)
+
+	start := time.Now()
+	_, err := NewClient(ts.URL, WithRequestTimeout(100*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request timeout not applied, took %s", elapsed)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	ts := hangingServer(t)
+
+	c, err := NewClient(ts.URL, WithServerVersion("2"), WithRequestTimeout(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, _, err := c.FindAssetByHostnameContext(ctx, "node1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.ExecAssetContext(ctx, "asset-1", "su-root", "uptime", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package jmsh
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTPSecret is a TOTP seed as enrolled in an authenticator app
+type OTPSecret struct {
+	Key       []byte
+	Digits    int
+	Period    int
+	Algorithm string
+}
+
+// ParseOTPSecret accepts an otpauth:// URI or a bare base32 secret
+func ParseOTPSecret(s string) (*OTPSecret, error) {
+	secret := &OTPSecret{Digits: 6, Period: 30, Algorithm: "SHA1"}
+
+	s = strings.TrimSpace(s)
+	encoded := s
+	if strings.HasPrefix(s, "otpauth://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host != "totp" {
+			return nil, fmt.Errorf("unsupported otp type %q, only totp is supported", u.Host)
+		}
+		q := u.Query()
+		encoded = q.Get("secret")
+		if d := q.Get("digits"); d != "" {
+			if secret.Digits, err = strconv.Atoi(d); err != nil {
+				return nil, fmt.Errorf("invalid digits %q", d)
+			}
+		}
+		if p := q.Get("period"); p != "" {
+			if secret.Period, err = strconv.Atoi(p); err != nil || secret.Period <= 0 {
+				return nil, fmt.Errorf("invalid period %q", p)
+			}
+		}
+		if a := q.Get("algorithm"); a != "" {
+			secret.Algorithm = strings.ToUpper(a)
+		}
+	}
+
+	// authenticator apps show secret grouped, lowercased and unpadded
+	encoded = strings.ToUpper(strings.Replace(encoded, " ", "", -1))
+	encoded = strings.TrimRight(encoded, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otp secret: %s", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty otp secret")
+	}
+	secret.Key = key
+
+	if secret.hash() == nil {
+		return nil, fmt.Errorf("unsupported otp algorithm %q", secret.Algorithm)
+	}
+	if secret.Digits < 6 || secret.Digits > 10 {
+		return nil, fmt.Errorf("invalid digits %d", secret.Digits)
+	}
+	return secret, nil
+}
+
+func (s *OTPSecret) hash() func() hash.Hash {
+	switch s.Algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Code generates RFC 6238 code for time t
+func (s *OTPSecret) Code(t time.Time) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/int64(s.Period)))
+
+	mac := hmac.New(s.hash(), s.Key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint64(1)
+	for i := 0; i < s.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", s.Digits, uint64(value)%mod)
+}
+
+// PeriodDuration returns how long a code is valid
+func (s *OTPSecret) PeriodDuration() time.Duration {
+	return time.Duration(s.Period) * time.Second
+}
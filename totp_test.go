@@ -0,0 +1,56 @@
+package jmsh
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestOTPSecretCode(t *testing.T) {
+	// test vectors from RFC 6238 appendix B
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	cases := []struct {
+		unix      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1234567890, "SHA256", "91819424"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tc := range cases {
+		uri := "otpauth://totp/jms:admin?digits=8&algorithm=" + tc.algorithm +
+			"&secret=" + base32.StdEncoding.EncodeToString([]byte(seeds[tc.algorithm]))
+		secret, err := ParseOTPSecret(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := secret.Code(time.Unix(tc.unix, 0)); code != tc.code {
+			t.Errorf("%s at %d: expected %s, got %s", tc.algorithm, tc.unix, tc.code, code)
+		}
+	}
+}
+
+func TestParseOTPSecret(t *testing.T) {
+	secret, err := ParseOTPSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Key) != "12345678901234567890" || secret.Digits != 6 || secret.Period != 30 {
+		t.Fatalf("unexpected secret: %#v", secret)
+	}
+
+	for _, s := range []string{"", "not base32!", "otpauth://hotp/x?secret=GEZDGNBV", "otpauth://totp/x?secret=GEZDGNBV&algorithm=MD5"} {
+		if _, err := ParseOTPSecret(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package jmsh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithDebug writes a trace of HTTP requests and koko messages into w, for
+// diagnosing login and connection problems. Cookies, tokens, passwords and
+// OTP codes are redacted, terminal data is reduced to its size
+func WithDebug(w io.Writer) Option {
+	return func(c *Client) error {
+		c.trace = &tracer{w: w}
+		return nil
+	}
+}
+
+const redacted = "REDACTED"
+
+// secretFields are query and form fields never written into trace
+var secretFields = map[string]bool{
+	"password":            true,
+	"csrfmiddlewaretoken": true,
+	"otp_code":            true,
+	"token":               true,
+}
+
+// tracer writes trace lines, a nil tracer discards them
+type tracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *tracer) printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
+
+// message traces a koko message sent (">") or received ("<")
+func (t *tracer) message(dir string, msg *Message) {
+	if t == nil {
+		return
+	}
+	t.printf("ws %s %s id=%s data=%d bytes", dir, msg.Type, msg.Id, len(msg.Data))
+}
+
+// traceTransport traces requests through client's transport, it sits
+// below authentication so that what is actually sent is traced
+type traceTransport struct {
+	c *Client
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := t.c.trace
+	if tr == nil {
+		return t.c.transport.RoundTrip(req)
+	}
+
+	tr.printf("http > %s %s", req.Method, redactURL(req.URL))
+	traceHeader(tr, "http >", req.Header)
+	if req.Header.Get("Content-Type") == "application/x-www-form-urlencoded" && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			content, _ := ioutil.ReadAll(body)
+			body.Close()
+			if form, err := url.ParseQuery(string(content)); err == nil {
+				tr.printf("http >   form: %s", redactValues(form))
+			}
+		}
+	}
+
+	start := time.Now()
+	r, err := t.c.transport.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		tr.printf("http < %s %s failed after %s: %s", req.Method, redactURL(req.URL), elapsed, err)
+		return nil, err
+	}
+	tr.printf("http < %s %s %s in %s", req.Method, redactURL(req.URL), r.Status, elapsed)
+	traceHeader(tr, "http <", r.Header)
+	return r, nil
+}
+
+// traceHeader writes header sorted by name, with secrets redacted
+func traceHeader(tr *tracer, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range header[name] {
+			tr.printf("%s   %s: %s", prefix, name, redactHeader(name, v))
+		}
+	}
+}
+
+func redactHeader(name, value string) string {
+	switch http.CanonicalHeaderKey(name) {
+	case "Cookie":
+		var cookies []string
+		for _, c := range strings.Split(value, ";") {
+			cookies = append(cookies, strings.SplitN(strings.TrimSpace(c), "=", 2)[0]+"="+redacted)
+		}
+		return strings.Join(cookies, "; ")
+	case "Set-Cookie":
+		return strings.SplitN(value, "=", 2)[0] + "=" + redacted
+	case "Authorization":
+		// keep the scheme, which tells authentication method
+		return strings.SplitN(value, " ", 2)[0] + " " + redacted
+	case "X-Csrftoken", "X-Jms-Csrftoken":
+		return redacted
+	case "Location":
+		if u, err := url.Parse(value); err == nil {
+			return redactURL(u)
+		}
+	}
+	return value
+}
+
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	u2 := *u
+	u2.RawQuery = redactValues(u.Query())
+	return u2.String()
+}
+
+func redactValues(values url.Values) string {
+	v2 := url.Values{}
+	for k, vs := range values {
+		for _, v := range vs {
+			if secretFields[k] {
+				v = redacted
+			}
+			v2.Add(k, v)
+		}
+	}
+	return v2.Encode()
+}
@@ -0,0 +1,47 @@
+package jmsh
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDebugTrace(t *testing.T) {
+	fs := newFakeJumpserver(t)
+
+	var buf bytes.Buffer
+	c := loginTo(t, fs, fs.URL, WithDebug(&buf))
+	c.trace.mu.Lock()
+	trace := buf.String()
+	c.trace.mu.Unlock()
+
+	for _, s := range []string{
+		"http > POST " + fs.URL + "/core/auth/login/",
+		"password=REDACTED",
+		"Set-Cookie: sessionid=REDACTED",
+		"ws > dial ws://" + strings.TrimPrefix(fs.URL, "http://") + "/koko/ws/terminal/",
+		"ws < CONNECT",
+		"ws > TERMINAL_INIT",
+		"ws < TERMINAL_DATA",
+	} {
+		if !strings.Contains(trace, s) {
+			t.Errorf("expected %q in trace:\n%s", s, trace)
+		}
+	}
+
+	u, _ := url.Parse(fs.URL)
+	for _, cookie := range c.Jar.Cookies(u) {
+		if strings.Contains(trace, cookie.Value) {
+			t.Errorf("cookie %s leaked into trace", cookie.Name)
+		}
+	}
+	if strings.Contains(trace, fs.password) {
+		t.Error("password leaked into trace")
+	}
+
+	u, _ = url.Parse("ws://jumpserver/koko/ws/token/?token=secret")
+	if got := redactURL(u); got != "ws://jumpserver/koko/ws/token/?token=REDACTED" {
+		t.Errorf("token not redacted: %s", got)
+	}
+}
@@ -0,0 +1,167 @@
+package jmsh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// loginTo logs in fake Jumpserver served at endpoint and runs a command,
+// which goes through both API and koko websocket
+func loginTo(t *testing.T, fs *fakeJumpserver, endpoint string, opts ...Option) *Client {
+	t.Helper()
+	c, err := NewClient(endpoint, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := c.FetchLoginPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lp.Submit(fs.username, fs.password, ""); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := c.ExecAsset("asset-1", "su-root", "uptime", &out); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// quietLog hides handshake errors test servers log for rejected clients
+var quietLog = log.New(ioutil.Discard, "", 0)
+
+func writePEM(t *testing.T, name, typ string, der []byte) string {
+	p := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCAFile(t *testing.T) {
+	fs := newFakeJumpserver(t)
+	ts := httptest.NewUnstartedServer(fs.Config.Handler)
+	ts.Config.ErrorLog = quietLog
+	ts.StartTLS()
+	defer ts.Close()
+
+	if _, err := NewClient(ts.URL); err == nil {
+		t.Fatal("expected certificate signed by unknown authority")
+	}
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+	loginTo(t, fs, ts.URL, WithCAFile(caFile))
+	loginTo(t, fs, ts.URL, WithInsecureSkipVerify())
+}
+
+func TestClientCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, "client.pem", "CERTIFICATE", der)
+	keyFile := writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+
+	fs := newFakeJumpserver(t)
+	ts := httptest.NewUnstartedServer(fs.Config.Handler)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	ts.Config.ErrorLog = quietLog
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	if _, err := NewClient(ts.URL, WithInsecureSkipVerify()); err == nil {
+		t.Fatal("expected handshake failure without client certificate")
+	}
+	loginTo(t, fs, ts.URL, WithInsecureSkipVerify(), WithClientCertificate(certFile, keyFile))
+}
+
+func TestProxy(t *testing.T) {
+	fs := newFakeJumpserver(t)
+
+	var requests, tunnels int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			atomic.AddInt32(&requests, 1)
+			r.RequestURI = ""
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			for k, v := range resp.Header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		atomic.AddInt32(&tunnels, 1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	defer proxy.Close()
+
+	loginTo(t, fs, fs.URL, WithProxy(proxy.URL))
+	if atomic.LoadInt32(&requests) == 0 || atomic.LoadInt32(&tunnels) == 0 {
+		t.Fatalf("expected both requests and websocket through proxy, got %d requests and %d tunnels", requests, tunnels)
+	}
+
+	if _, err := NewClient(fs.URL, WithProxy("ftp://proxy")); err == nil {
+		t.Fatal("expected unsupported proxy scheme")
+	}
+}